@@ -0,0 +1,62 @@
+package typeassert
+
+import "handler"
+
+type Pod struct {
+	Name string
+}
+
+type controller struct {
+	names []string
+}
+
+func (c *controller) addPod(obj interface{}) {
+	pod := obj.(*Pod) // want `handler addPod asserts obj to \*Pod without the comma-ok form: it panics on an unexpected type`
+	c.names = append(c.names, pod.Name)
+}
+
+func (c *controller) updatePod(oldObj, newObj interface{}) {
+	oldPod := oldObj.(*Pod) // want `handler updatePod asserts oldObj to \*Pod without the comma-ok form`
+	newPod, ok := newObj.(*Pod)
+	if !ok || oldPod.Name == newPod.Name {
+		return
+	}
+	c.names = append(c.names, newPod.Name)
+}
+
+func (c *controller) deletePod(obj interface{}) {
+	c.names = append(c.names, obj.(*Pod).Name) // want `handler deletePod asserts obj to \*Pod without the comma-ok form`
+}
+
+// notAHandler is not registered, so it is not checked.
+func (c *controller) notAHandler(obj interface{}) {
+	pod := obj.(*Pod)
+	c.names = append(c.names, pod.Name)
+}
+
+// other is not a controller: its addPod is not the handler.
+type other struct{}
+
+func (o *other) addPod(obj interface{}) {
+	pod := obj.(*Pod)
+	_ = pod.Name
+}
+
+func addAllEventHandlers(c *controller) {
+	handler.AddEventHandler(
+		handler.ResourceEventHandlerFuncs{
+			AddFunc:    c.addPod,
+			UpdateFunc: c.updatePod,
+			DeleteFunc: c.deletePod,
+		},
+	)
+	handler.AddEventHandler(handler.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool { return true },
+		Handler: handler.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				pod := obj.(*Pod) // want `handler addAllEventHandlers\$\d asserts obj to \*Pod without the comma-ok form`
+				c.names = append(c.names, pod.Name)
+			},
+		},
+	})
+}
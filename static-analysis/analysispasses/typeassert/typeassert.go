@@ -0,0 +1,182 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package typeassert
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/ssa"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "typeassert",
+	Doc:      "report the type assertions on the parameters of the handlers which panic on an unexpected type",
+	Run:      run,
+	Requires: []*analysis.Analyzer{inspect.Analyzer, buildssa.Analyzer},
+}
+
+// registrationAPIs are the methods of the informers registering the handlers.
+var registrationAPIs = map[string]struct{}{"AddEventHandler": {}, "AddEventHandlerWithResyncPeriod": {}}
+
+// handlers are the functions registered as handlers: the declared ones by their objects,
+// and the function literals by their syntax.
+type handlers struct {
+	funcs map[*types.Func]struct{}
+	lits  map[*ast.FuncLit]struct{}
+}
+
+// add records the handlers of the handler expression registered, e.g.
+// cache.ResourceEventHandlerFuncs{AddFunc: c.addPod} or a FilteringResourceEventHandler.
+func (h handlers) add(info *types.Info, e ast.Expr) {
+	e = ast.Unparen(e)
+	if ue, ok := e.(*ast.UnaryExpr); ok && ue.Op == token.AND {
+		e = ast.Unparen(ue.X)
+	}
+	cpl, ok := e.(*ast.CompositeLit)
+	if !ok {
+		return
+	}
+	for _, elt := range cpl.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		switch key.Name {
+		case "AddFunc", "UpdateFunc", "DeleteFunc":
+			switch v := ast.Unparen(kv.Value).(type) {
+			case *ast.FuncLit:
+				h.lits[v] = struct{}{}
+			case *ast.SelectorExpr:
+				if fn, ok := info.Uses[v.Sel].(*types.Func); ok {
+					h.funcs[fn] = struct{}{}
+				}
+			case *ast.Ident:
+				if fn, ok := info.Uses[v].(*types.Func); ok {
+					h.funcs[fn] = struct{}{}
+				}
+			}
+		case "Handler":
+			h.add(info, kv.Value)
+		}
+	}
+}
+
+// has tells whether fn is one of the handlers.
+func (h handlers) has(fn *ssa.Function) bool {
+	if obj, ok := fn.Object().(*types.Func); ok {
+		_, found := h.funcs[obj]
+		return found
+	}
+	if lit, ok := fn.Syntax().(*ast.FuncLit); ok {
+		_, found := h.lits[lit]
+		return found
+	}
+	return false
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	ssaInput := pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA)
+
+	// the handlers registered in the package, e.g. informer.AddEventHandler(cache.ResourceEventHandlerFuncs{...})
+	registered := handlers{funcs: map[*types.Func]struct{}{}, lits: map[*ast.FuncLit]struct{}{}}
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		ce := n.(*ast.CallExpr)
+		var name string
+		switch fun := ast.Unparen(ce.Fun).(type) {
+		case *ast.SelectorExpr:
+			name = fun.Sel.Name
+		case *ast.Ident:
+			name = fun.Name
+		}
+		if _, ok := registrationAPIs[name]; !ok || len(ce.Args) == 0 {
+			return
+		}
+		registered.add(pass.TypesInfo, ce.Args[0])
+	})
+	if len(registered.funcs) == 0 && len(registered.lits) == 0 {
+		return nil, nil
+	}
+
+	// the statements like pod := obj.(*v1.Pod), indexed by the position of the assertion
+	assigns := map[token.Pos]*ast.AssignStmt{}
+	nodeFilter := []ast.Node{
+		(*ast.AssignStmt)(nil),
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		as := n.(*ast.AssignStmt)
+		if as.Tok != token.DEFINE || len(as.Lhs) != 1 || len(as.Rhs) != 1 {
+			return
+		}
+		if ta, ok := ast.Unparen(as.Rhs[0]).(*ast.TypeAssertExpr); ok {
+			assigns[ta.Lparen] = as
+		}
+	})
+
+	for _, fn := range ssaInput.SrcFuncs {
+		if !registered.has(fn) {
+			continue
+		}
+		params := fn.Params
+		if fn.Signature.Recv() != nil {
+			params = params[1:]
+		}
+		// Update handlers are checked for both oldObj and newObj
+		for _, param := range params {
+			for _, ref := range *param.Referrers() {
+				ta, ok := ref.(*ssa.TypeAssert)
+				if !ok || ta.CommaOk || ta.X != param {
+					continue
+				}
+				diag := analysis.Diagnostic{
+					Pos: ta.Pos(),
+					Message: fmt.Sprintf("handler %s asserts %s to %s without the comma-ok form: it panics on an unexpected type",
+						fn.Name(), param.Name(), types.TypeString(ta.AssertedType, types.RelativeTo(pass.Pkg))),
+				}
+				if as, ok := assigns[ta.Pos()]; ok && fn.Signature.Results().Len() == 0 {
+					diag.SuggestedFixes = []analysis.SuggestedFix{commaOkFix(pass.Fset, as)}
+				}
+				pass.Report(diag)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// commaOkFix rewrites pod := obj.(*v1.Pod) to the comma-ok form, returning on an unexpected type.
+func commaOkFix(fset *token.FileSet, as *ast.AssignStmt) analysis.SuggestedFix {
+	ta := ast.Unparen(as.Rhs[0]).(*ast.TypeAssertExpr)
+	text := fmt.Sprintf("%s, ok := %s.(%s)\nif !ok {\n\treturn\n}",
+		render(fset, as.Lhs[0]), render(fset, ta.X), render(fset, ta.Type))
+	return analysis.SuggestedFix{
+		Message: "Use the comma-ok form",
+		TextEdits: []analysis.TextEdit{{
+			Pos:     as.Pos(),
+			End:     as.End(),
+			NewText: []byte(text),
+		}},
+	}
+}
+
+// render returns the pretty-print of the given node
+func render(fset *token.FileSet, x interface{}) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, x); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
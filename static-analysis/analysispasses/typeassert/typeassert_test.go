@@ -0,0 +1,14 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package typeassert
+
+import (
+	"golang.org/x/tools/go/analysis/analysistest"
+	"testing"
+)
+
+func TestTypeAssert(t *testing.T) {
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), Analyzer, "typeassert")
+}
@@ -0,0 +1,404 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"kubetorch/ssapasses/analyzer"
+	"kubetorch/ssapasses/checker"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Config is the optional YAML config. The flags of the subcommands override it.
+type Config struct {
+	// Profile is a built-in config whose values are used for the keys not set here, see profiles
+	Profile string `yaml:"profile"`
+	// Packages are the package patterns to analyze, loaded together. check also reports
+	// the write-write conflicts between them.
+	Packages []string `yaml:"packages"`
+	// Dir is the directory the packages are loaded from, e.g. the root of a Kubernetes
+	// checkout in module mode. The current directory when empty.
+	Dir           string        `yaml:"dir"`
+	Build         Build         `yaml:"build"`
+	Registrations Registrations `yaml:"registrations"`
+	Entries       Entries       `yaml:"entries"`
+	Sinks         Sinks         `yaml:"sinks"`
+	// Barriers and Sanitizers are added to the default models of the tracker
+	Barriers   []string `yaml:"barriers"`
+	Sanitizers []string `yaml:"sanitizers"`
+	// Readers and Containers are added to the models of the read points of the tracker
+	Readers    []tracker.Reader    `yaml:"readers"`
+	Containers []tracker.Container `yaml:"containers"`
+	Budgets    tracker.Budgets     `yaml:"budgets"`
+	// Implicit enables the control dependence (implicit flow) taint
+	Implicit bool `yaml:"implicit"`
+	// StaleReads reports the informer cache reads flowing into API writes
+	StaleReads bool `yaml:"staleReads"`
+	// Checks are the names of the checkers to run, see the checker package
+	Checks []string `yaml:"checks"`
+	// Output is the format of the output of the subcommand, see formats
+	Output string `yaml:"output"`
+	// Collapse is an option of the "dot" and "mermaid" outputs
+	Collapse bool `yaml:"collapse"`
+
+	// path and lines locate the keys of the file in the errors, flags are the keys set by flags
+	path    string
+	lines   map[string]int
+	flags   map[string]string
+	handler *regexp.Regexp
+}
+
+// Registrations are the functions and methods registering the handlers.
+type Registrations struct {
+	// Functions are searched for registrations, all the functions of the packages when empty
+	Functions []string `yaml:"functions"`
+	// Methods register the handlers, collector.DefaultRegistrationAPIs when empty
+	Methods []string `yaml:"methods"`
+}
+
+// Build is the build configuration the packages are loaded with, see collector.LoadConfig.
+type Build struct {
+	Tags   []string `yaml:"tags"`
+	GOOS   string   `yaml:"goos"`
+	GOARCH string   `yaml:"goarch"`
+	// Tests loads the test files of the packages too
+	Tests bool `yaml:"tests"`
+	// Env are more environment variables of the go command, as KEY=VALUE
+	Env []string `yaml:"env"`
+}
+
+var (
+	buildTag = regexp.MustCompile(`^[\w.]+$`)
+	platform = regexp.MustCompile(`^[a-z0-9]+$`)
+)
+
+// Entries select the entry points to analyze. The empty fields select everything.
+type Entries struct {
+	// Handler is a regexp matching the whole name of the handlers and triggers
+	Handler string   `yaml:"handler"`
+	Kinds   []string `yaml:"kinds"`
+	Events  []string `yaml:"events"`
+}
+
+// Sinks are added to the catalog of terminations of the tracker.
+type Sinks struct {
+	// Payloads map the qualified names of the payload types to their sinks
+	Payloads map[string]tracker.Sink `yaml:"payloads"`
+	// Methods map the methods of the typed clients to the part they mutate
+	Methods map[string]tracker.Sink `yaml:"methods"`
+}
+
+// profiles are the built-in configs. scheduler holds the defaults the tool was written with.
+var profiles = map[string]func() *Config{
+	"scheduler": func() *Config {
+		return &Config{
+			Packages:      []string{"k8s.io/kubernetes/pkg/scheduler"},
+			Registrations: Registrations{Functions: []string{"addAllEventHandlers"}},
+			Barriers:      []string{"k8s.io/kubernetes/pkg/scheduler/metrics"},
+			// the cache written by the handlers is read by the algorithm scheduling the next pod
+			Readers: []tracker.Reader{
+				{Type: "k8s.io/kubernetes/pkg/scheduler.Scheduler", Method: "scheduleOne", Call: "Schedule", Field: 0},
+			},
+		}
+	},
+}
+
+// formats are the output formats of each subcommand, the first one is the default.
+var formats = map[string][]string{
+	"collect": {"text", "json"},
+	"track":   {"text"},
+	"graph":   {"json", "dot", "mermaid", "html"},
+	"check":   {"text", "sarif"},
+	"diff":    {"text"},
+}
+
+// events are the events of the handlers and the triggers.
+var events = []string{"Add", "Update", "Delete", collector.Periodic, collector.Requeue}
+
+// parts are the parts of the objects the sinks mutate.
+var parts = []tracker.Part{tracker.PartSpec, tracker.PartStatus, tracker.PartMetadata, tracker.PartSubresource, tracker.PartObject}
+
+// loadConfig reads the config at path on top of the profile, which is the one named
+// in the file when empty. Unknown keys are errors, so that typos are not ignored.
+func loadConfig(path, profile string) (*Config, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("config: %v", err)
+		}
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	config := &Config{path: path, lines: locate(&doc), flags: map[string]string{}}
+	if profile != "" {
+		config.flags["profile"] = "-profile"
+	} else {
+		named := struct {
+			Profile string `yaml:"profile"`
+		}{}
+		if err := doc.Decode(&named); err != nil && doc.Kind != 0 {
+			return nil, fmt.Errorf("config %s: %v", path, err)
+		}
+		profile = named.Profile
+	}
+	if profile != "" {
+		newProfile, found := profiles[profile]
+		if !found {
+			return nil, config.errorf("profile", "unknown profile %q, available: %v", profile, profileNames())
+		}
+		base := newProfile()
+		base.path, base.lines, base.flags = config.path, config.lines, config.flags
+		config = base
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	config.Profile = profile
+	return config, nil
+}
+
+func profileNames() []string {
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// locate returns the lines of the keys and of the items of the sequences in the
+// YAML document, by path, e.g. "entries.handler" or "readers[0].type".
+func locate(doc *yaml.Node) map[string]int {
+	lines := map[string]int{}
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, content := range node.Content {
+				walk(content, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				if path != "" {
+					key = path + "." + key
+				}
+				if _, found := lines[key]; !found {
+					lines[key] = node.Content[i].Line
+				}
+				walk(node.Content[i+1], key)
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				key := fmt.Sprintf("%s[%d]", path, i)
+				lines[key] = item.Line
+				walk(item, key)
+			}
+		}
+	}
+	walk(doc, "")
+	return lines
+}
+
+// errorf returns an error about the field of the config, located at its line in the
+// file or at the flag setting it. A field missing from the file is located at the
+// closest key, e.g. "checks" for the items of a flow sequence "checks[1]".
+func (c *Config) errorf(field, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	for path := field; path != ""; path = parentPath(path) {
+		if flag, found := c.flags[path]; found {
+			return fmt.Errorf("flag %s: %s", flag, msg)
+		}
+		if line, found := c.lines[path]; found {
+			return fmt.Errorf("config %s:%d: %s: %s", c.path, line, field, msg)
+		}
+	}
+	return fmt.Errorf("%s: %s", field, msg)
+}
+
+// parentPath returns the path of the map or the sequence holding the field.
+func parentPath(path string) string {
+	if i := strings.LastIndexAny(path, ".["); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// errorList is the list of the errors found in the config.
+type errorList []error
+
+func (l errorList) Error() string {
+	msgs := []string{}
+	for _, err := range l {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func sortedKeys(m map[string]tracker.Sink) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validate checks the config of the subcommand once the flags are applied,
+// and reports all the errors found.
+func (c *Config) validate(command string) error {
+	errs := errorList{}
+	if command != "diff" && len(c.Packages) == 0 {
+		errs = append(errs, c.errorf("packages", "no package to analyze: set packages in the config or -pkg"))
+	}
+	if info, err := os.Stat(c.Dir); c.Dir != "" && (err != nil || !info.IsDir()) {
+		errs = append(errs, c.errorf("dir", "%s is not a directory", c.Dir))
+	}
+	if c.Output == "" {
+		c.Output = formats[command][0]
+	}
+	if !collector.Contains(formats[command], c.Output) {
+		errs = append(errs, c.errorf("output", "invalid output %q for %s, available: %v", c.Output, command, formats[command]))
+	}
+	if len(c.Packages) > 1 && (command == "graph" || command == "collect" && c.Output == "json") {
+		errs = append(errs, c.errorf("packages", "%s -output %s takes one package, but %d are given", command, c.Output, len(c.Packages)))
+	}
+	for i, name := range c.Checks {
+		if !collector.Contains(checker.Names(), name) {
+			errs = append(errs, c.errorf(fmt.Sprintf("checks[%d]", i), "unknown checker %q, available: %v", name, checker.Names()))
+		}
+	}
+
+	if c.Entries.Handler != "" {
+		handler, err := regexp.Compile("^(?:" + c.Entries.Handler + ")$")
+		if err != nil {
+			errs = append(errs, c.errorf("entries.handler", "%v", err))
+		}
+		c.handler = handler
+	}
+	for i, event := range c.Entries.Events {
+		if !collector.Contains(events, event) {
+			errs = append(errs, c.errorf(fmt.Sprintf("entries.events[%d]", i), "unknown event %q, available: %v", event, events))
+		}
+	}
+
+	for i, tag := range c.Build.Tags {
+		if !buildTag.MatchString(tag) {
+			errs = append(errs, c.errorf(fmt.Sprintf("build.tags[%d]", i), "invalid build tag %q", tag))
+		}
+	}
+	if c.Build.GOOS != "" && !platform.MatchString(c.Build.GOOS) {
+		errs = append(errs, c.errorf("build.goos", "invalid GOOS %q", c.Build.GOOS))
+	}
+	if c.Build.GOARCH != "" && !platform.MatchString(c.Build.GOARCH) {
+		errs = append(errs, c.errorf("build.goarch", "invalid GOARCH %q", c.Build.GOARCH))
+	}
+	for i, env := range c.Build.Env {
+		if strings.Index(env, "=") <= 0 {
+			errs = append(errs, c.errorf(fmt.Sprintf("build.env[%d]", i), "invalid variable %q, expected KEY=VALUE", env))
+		}
+	}
+
+	for _, name := range sortedKeys(c.Sinks.Payloads) {
+		field := "sinks.payloads." + name
+		sink := c.Sinks.Payloads[name]
+		if sink.Resource == "" {
+			errs = append(errs, c.errorf(field, "missing resource"))
+		}
+		errs = append(errs, c.validatePart(field, sink)...)
+	}
+	for _, name := range sortedKeys(c.Sinks.Methods) {
+		errs = append(errs, c.validatePart("sinks.methods."+name, c.Sinks.Methods[name])...)
+	}
+
+	for i, r := range c.Readers {
+		field := fmt.Sprintf("readers[%d]", i)
+		if r.Type == "" || r.Method == "" || r.Call == "" {
+			errs = append(errs, c.errorf(field, "type, method and call are required"))
+		}
+		if r.Field < 0 {
+			errs = append(errs, c.errorf(field+".field", "negative field %d", r.Field))
+		}
+	}
+	for i, container := range c.Containers {
+		field := fmt.Sprintf("containers[%d]", i)
+		if container.Type == "" {
+			errs = append(errs, c.errorf(field, "missing type"))
+		}
+		if len(container.Writes) == 0 || len(container.Reads) == 0 {
+			errs = append(errs, c.errorf(field, "writes and reads are required"))
+		}
+	}
+	if c.Budgets.Functions < 0 {
+		errs = append(errs, c.errorf("budgets.functions", "negative budget %d", c.Budgets.Functions))
+	}
+	if c.Budgets.Depth < 0 {
+		errs = append(errs, c.errorf("budgets.depth", "negative budget %d", c.Budgets.Depth))
+	}
+	if c.Budgets.Guards < 0 {
+		errs = append(errs, c.errorf("budgets.guards", "negative budget %d", c.Budgets.Guards))
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// validatePart checks the part of the sink at field, and its subresource.
+func (c *Config) validatePart(field string, sink tracker.Sink) []error {
+	errs := []error{}
+	valid := false
+	for _, part := range parts {
+		valid = valid || sink.Part == part
+	}
+	if !valid {
+		errs = append(errs, c.errorf(field+".part", "invalid part %q, available: %v", sink.Part, parts))
+	}
+	if (sink.Part == tracker.PartSubresource) != (sink.Subresource != "") {
+		errs = append(errs, c.errorf(field+".subresource", "a subresource is required by the part subresource only"))
+	}
+	return errs
+}
+
+// options returns the options of the analysis of the config.
+func (c *Config) options() analyzer.Options {
+	return analyzer.Options{
+		Packages: c.Packages,
+		Load: collector.LoadConfig{
+			Dir:    c.Dir,
+			Tags:   c.Build.Tags,
+			GOOS:   c.Build.GOOS,
+			GOARCH: c.Build.GOARCH,
+			Tests:  c.Build.Tests,
+			Env:    c.Build.Env,
+		},
+		Registrars:       c.Registrations.Functions,
+		RegistrationAPIs: c.Registrations.Methods,
+		Filter:           collector.Filter{Handler: c.handler, Kinds: c.Entries.Kinds, Events: c.Entries.Events},
+		Barriers:         c.Barriers,
+		Sanitizers:       c.Sanitizers,
+		PayloadSinks:     c.Sinks.Payloads,
+		MethodSinks:      c.Sinks.Methods,
+		Readers:          c.Readers,
+		Containers:       c.Containers,
+		Budgets:          c.Budgets,
+		ImplicitFlow:     c.Implicit,
+		Checks:           c.Checks,
+	}
+}
@@ -5,39 +5,335 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
-	"kubetorch/ssapasses/collector"
-	"kubetorch/ssapasses/tracker"
+	"io"
+	"kubetorch/ssapasses/analyzer"
+	"kubetorch/ssapasses/checker"
+	"kubetorch/ssapasses/report"
 	"os"
+	"strings"
 )
 
-type Config struct {
-	Pkg     string `yaml:"pkg"`
-	Handler string `yaml:"handler"`
+// Exit codes of the subcommands.
+const (
+	exitOK = 0
+	// exitFindings is returned by check when something is found, and by diff when the graphs differ.
+	exitFindings = 1
+	exitUsage    = 2
+	exitError    = 3
+)
+
+const usage = `usage: kubetorch <command> [flags]
+
+commands:
+  collect  list the handlers and the triggers of a package
+  track    print the side effects of the entry points
+  graph    write the informer dependency graph (json, dot, mermaid, html)
+  check    run the checkers (text, sarif)
+  diff     compare two graphs written by "graph -output json"
+
+Run "kubetorch <command> -h" for the flags of a command.
+`
+
+// listFlag is a flag of comma separated values, which may also be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
 }
 
-func config() *Config {
-	data, _ := ioutil.ReadFile("config.yaml")
-	config := Config{}
-	err := yaml.Unmarshal([]byte(data), &config)
-	if err != nil {
-		return nil
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
 	}
-	return &config
+	return nil
+}
+
+// repeatedFlag is a flag which may be repeated, its values are not split, e.g. GOFLAGS=-a -b.
+type repeatedFlag []string
+
+func (r *repeatedFlag) String() string {
+	return strings.Join(*r, " ")
+}
+
+func (r *repeatedFlag) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// command is a subcommand writing to out and errOut. It returns its exit code.
+type command func(config *Config, args []string, out, errOut io.Writer) int
+
+var commands = map[string]command{
+	"collect": collect,
+	"track":   track,
+	"graph":   graph,
+	"check":   check,
+	"diff":    diff,
 }
 
 func main() {
-	config := config()
-	if config == nil {
-		fmt.Println("user config invalid")
-		os.Exit(1)
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, out, errOut io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "help" {
+		fmt.Fprint(errOut, usage)
+		return exitUsage
+	}
+	name := args[0]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(errOut, "kubetorch: unknown command %q\n\n%s", name, usage)
+		return exitUsage
+	}
+
+	// the flags override the config, which is read first
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	configPath := flags.String("config", "", "path of the optional YAML config")
+	profile := flags.String("profile", "", fmt.Sprintf("built-in config the config overrides, among %v", profileNames()))
+	dir := flags.String("dir", "", "directory the packages are loaded from, e.g. a Kubernetes checkout in module mode")
+	goos := flags.String("goos", "", "GOOS the packages are loaded for, the one of the go command when empty")
+	goarch := flags.String("goarch", "", "GOARCH the packages are loaded for, the one of the go command when empty")
+	tests := flags.Bool("tests", false, "also load the test files of the packages")
+	handler := flags.String("handler", "", "regexp matching the names of the handlers and triggers to analyze, all when empty")
+	output := flags.String("output", "", fmt.Sprintf("output format: %s", strings.Join(formats[name], ", ")))
+	implicit := flags.Bool("implicit", false, "also track the sinks guarded by tainted branches")
+	staleReads := flags.Bool("stale-reads", false, "track: report the cache reads flowing into API writes")
+	collapse := flags.Bool("collapse", false, "graph: merge the nodes of each controller")
+	var pkgs, checks, kinds, entryEvents, tags listFlag
+	var env repeatedFlag
+	flags.Var(&pkgs, "pkg", "package patterns to analyze, check also reports the conflicts between them")
+	flags.Var(&checks, "checks", fmt.Sprintf("check: checkers to run, among %v", checker.Names()))
+	flags.Var(&kinds, "kinds", "analyze the handlers of the informers of these kinds only")
+	flags.Var(&entryEvents, "events", fmt.Sprintf("analyze the handlers and triggers of these events only, among %v", events))
+	flags.Var(&tags, "tags", "build tags the packages are loaded with, e.g. providerless")
+	flags.Var(&env, "env", "environment variable of the go command as KEY=VALUE, e.g. CGO_ENABLED=0, repeated for more")
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+
+	config, err := loadConfig(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintln(errOut, "kubetorch:", err)
+		return exitUsage
+	}
+	// the errors about the values set by flags name the flags
+	fields := map[string]string{"pkg": "packages", "handler": "entries.handler", "kinds": "entries.kinds", "events": "entries.events",
+		"tags": "build.tags", "goos": "build.goos", "goarch": "build.goarch", "tests": "build.tests", "env": "build.env"}
+	flags.Visit(func(f *flag.Flag) {
+		field, found := fields[f.Name]
+		if !found {
+			field = f.Name
+		}
+		config.flags[field] = "-" + f.Name
+		switch f.Name {
+		case "pkg":
+			config.Packages = pkgs
+		case "dir":
+			config.Dir = *dir
+		case "tags":
+			config.Build.Tags = tags
+		case "goos":
+			config.Build.GOOS = *goos
+		case "goarch":
+			config.Build.GOARCH = *goarch
+		case "tests":
+			config.Build.Tests = *tests
+		case "env":
+			config.Build.Env = env
+		case "handler":
+			config.Entries.Handler = *handler
+		case "output":
+			config.Output = *output
+		case "implicit":
+			config.Implicit = *implicit
+		case "stale-reads":
+			config.StaleReads = *staleReads
+		case "collapse":
+			config.Collapse = *collapse
+		case "checks":
+			config.Checks = checks
+		case "kinds":
+			config.Entries.Kinds = kinds
+		case "events":
+			config.Entries.Events = entryEvents
+		}
+	})
+	if err := config.validate(name); err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintln(errOut, "kubetorch:", line)
+		}
+		return exitUsage
+	}
+	return cmd(config, flags.Args(), out, errOut)
+}
+
+// analyze runs the analysis of the config, with the results the command needs set by
+// need. The errors are written to errOut.
+func analyze(config *Config, errOut io.Writer, need func(opts *analyzer.Options)) (*analyzer.Result, bool) {
+	opts := config.options()
+	need(&opts)
+	result, err := analyzer.Analyze(context.Background(), opts)
+	if err != nil {
+		fmt.Fprintln(errOut, "kubetorch:", err)
+		return nil, false
+	}
+	return result, true
+}
+
+// skipped writes the diagnostics of the result to errOut, once the command has used it.
+func skipped(result *analyzer.Result, errOut io.Writer) {
+	for _, d := range result.Diagnostics() {
+		fmt.Fprintln(errOut, "kubetorch: skipped", d)
+	}
+}
+
+// single tells whether the patterns matched one package, as the command needs.
+func single(result *analyzer.Result, command string, errOut io.Writer) bool {
+	if len(result.Components) != 1 {
+		fmt.Fprintf(errOut, "kubetorch: %s takes one package, but the patterns match %d\n", command, len(result.Components))
+		return false
 	}
+	return true
+}
 
-	fmt.Println("find side effects for", config.Handler, "in", config.Pkg)
-	collector := collector.NewCollector(config.Pkg)
-	collector.CollectEntryPoints()
-	tracker := tracker.NewTracker(collector)
-	tracker.TrackEntryPoints(config.Handler)
+func collect(config *Config, args []string, out, errOut io.Writer) int {
+	result, ok := analyze(config, errOut, func(opts *analyzer.Options) {})
+	if !ok || config.Output == "json" && !single(result, "collect -output json", errOut) {
+		return exitError
+	}
+	defer skipped(result, errOut)
+	for _, component := range result.Components {
+		if config.Output == "json" {
+			if err := report.NewGraph(component.Collector, nil, "").WriteJSON(out); err != nil {
+				fmt.Fprintln(errOut, "kubetorch:", err)
+				return exitError
+			}
+			continue
+		}
+		for _, e := range component.Entries {
+			position := result.Prog.Fset.Position(e.Call.Pos())
+			fmt.Fprintf(out, "%s:%d: %s %s", position.Filename, position.Line, e.API, e.Event)
+			if e.Kind != "" {
+				fmt.Fprintf(out, " of the %s informer", e.Kind)
+			}
+			fmt.Fprintf(out, ": %s#%s\n", e.Handler, e.Event)
+		}
+	}
+	return exitOK
+}
+
+func track(config *Config, args []string, out, errOut io.Writer) int {
+	result, ok := analyze(config, errOut, func(opts *analyzer.Options) {
+		opts.Chains = true
+		opts.StaleReads = config.StaleReads
+	})
+	if !ok {
+		return exitError
+	}
+	defer skipped(result, errOut)
+	for _, component := range result.Components {
+		fmt.Fprintln(out, "find side effects for", config.Entries.Handler, "in", component.Package)
+		component.Tracker.Fprint(out, component.Chains)
+		if config.StaleReads {
+			component.Tracker.FprintStaleReads(out, component.StaleReads)
+		}
+	}
+	return exitOK
+}
+
+func graph(config *Config, args []string, out, errOut io.Writer) int {
+	result, ok := analyze(config, errOut, func(opts *analyzer.Options) {})
+	if !ok || !single(result, "graph", errOut) {
+		return exitError
+	}
+	defer skipped(result, errOut)
+	component := result.Components[0]
+	g := report.NewGraph(component.Collector, component.Tracker, "")
+	opts := report.ExportOptions{Collapse: config.Collapse}
+	var err error
+	switch config.Output {
+	case "dot":
+		err = g.WriteDOT(out, opts)
+	case "mermaid":
+		err = g.WriteMermaid(out, opts)
+	case "html":
+		err = g.WriteHTML(out)
+	default:
+		err = g.WriteJSON(out)
+	}
+	if err != nil {
+		fmt.Fprintln(errOut, "kubetorch:", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func check(config *Config, args []string, out, errOut io.Writer) int {
+	result, ok := analyze(config, errOut, func(opts *analyzer.Options) {
+		if len(opts.Checks) == 0 {
+			opts.Checks = checker.Names()
+		}
+		// the conflicts between the packages matched, also by a single pattern
+		opts.Conflicts = true
+	})
+	if !ok {
+		return exitError
+	}
+	defer skipped(result, errOut)
+	findings := result.Findings()
+	if config.Output == "sarif" {
+		// the chains of all the packages
+		graphs := []*report.Graph{}
+		for _, component := range result.Components {
+			graphs = append(graphs, report.NewGraph(component.Collector, component.Tracker, ""))
+		}
+		root, _ := os.Getwd()
+		if err := report.WriteSARIF(out, graphs, findings, root); err != nil {
+			fmt.Fprintln(errOut, "kubetorch:", err)
+			return exitError
+		}
+	} else {
+		result.Components[0].Checker.Fprint(out, findings)
+	}
+	if len(findings) != 0 {
+		return exitFindings
+	}
+	return exitOK
+}
+
+func diff(config *Config, args []string, out, errOut io.Writer) int {
+	if len(args) != 2 {
+		fmt.Fprintln(errOut, "kubetorch: diff needs two graphs: kubetorch diff old.json new.json")
+		return exitUsage
+	}
+	graphs := []*report.Graph{}
+	for _, path := range args {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(errOut, "kubetorch:", err)
+			return exitError
+		}
+		g, err := report.ReadJSON(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(errOut, "kubetorch: %s: %v\n", path, err)
+			return exitError
+		}
+		graphs = append(graphs, g)
+	}
+	lines := report.Diff(graphs[0], graphs[1])
+	for _, line := range lines {
+		fmt.Fprintln(out, line)
+	}
+	if len(lines) != 0 {
+		return exitFindings
+	}
+	return exitOK
 }
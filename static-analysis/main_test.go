@@ -0,0 +1,191 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testdataPkg = "kubetorch/ssapasses/tracker/testdata"
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "kubetorch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUsageErrors(t *testing.T) {
+	cases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{}, "usage: kubetorch"},
+		{[]string{"run"}, `unknown command "run"`},
+		{[]string{"graph"}, "packages: no package to analyze"},
+		{[]string{"graph", "-pkg", testdataPkg, "-output", "sarif"}, `flag -output: invalid output "sarif" for graph`},
+		{[]string{"graph", "-pkg", testdataPkg + ",kubetorch/ssapasses/checker/testdata"}, "flag -pkg: graph -output json takes one package"},
+		{[]string{"check", "-pkg", testdataPkg, "-checks", "deepcopy,races"}, `flag -checks: unknown checker "races"`},
+		{[]string{"track", "-pkg", testdataPkg, "-handler", "add("}, "flag -handler: error parsing regexp"},
+		{[]string{"track", "-profile", "controller"}, `flag -profile: unknown profile "controller"`},
+		{[]string{"track", "-config", "missing.yaml"}, "config: open missing.yaml"},
+		{[]string{"track", "-config", writeConfig(t, "packages: [a]\nhandlr: b\n")}, "line 2: field handlr not found"},
+		{[]string{"track", "-config", writeConfig(t, "packages: [a\n")}, "yaml: line"},
+		{[]string{"diff", "old.json"}, "diff needs two graphs"},
+	}
+	for _, c := range cases {
+		var out, errOut bytes.Buffer
+		if code := run(c.args, &out, &errOut); code != exitUsage {
+			t.Errorf("%v: exit code should be %d, but %d actually", c.args, exitUsage, code)
+		}
+		if !strings.Contains(errOut.String(), c.err) {
+			t.Errorf("%v: error should contain %q, but %q actually", c.args, c.err, errOut.String())
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	path := writeConfig(t, `profile: scheduler
+packages: [kubetorch/ssapasses/tracker/testdata]
+entries:
+  handler: "add(Pod"
+  events: [Add, Created]
+sinks:
+  methods:
+    Approve: {part: approval}
+readers:
+  - type: k8s.io/kubernetes/pkg/scheduler.Scheduler
+    method: scheduleOne
+budgets:
+  depth: -1
+`)
+	var out, errOut bytes.Buffer
+	if code := run([]string{"track", "-config", path}, &out, &errOut); code != exitUsage {
+		t.Errorf("exit code should be %d, but %d actually", exitUsage, code)
+	}
+	expected := []string{
+		"kubetorch: config " + path + ":4: entries.handler: error parsing regexp: missing closing ): `^(?:add(Pod)$`",
+		"kubetorch: config " + path + `:5: entries.events[1]: unknown event "Created", available: [Add Update Delete Periodic Requeue]`,
+		"kubetorch: config " + path + `:8: sinks.methods.Approve.part: invalid part "approval", available: [spec status metadata subresource object]`,
+		"kubetorch: config " + path + ":10: readers[0]: type, method and call are required",
+		"kubetorch: config " + path + ":13: budgets.depth: negative budget -1",
+		"",
+	}
+	if actual := strings.Split(errOut.String(), "\n"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("errors should be\n%s\nbut\n%s\nactually", strings.Join(expected, "\n"), errOut.String())
+	}
+}
+
+func TestProfile(t *testing.T) {
+	config, err := loadConfig(writeConfig(t, "profile: scheduler\nbarriers: [k8s.io/kubernetes/pkg/scheduler/util]\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the keys of the file override the profile, the others are kept
+	if !reflect.DeepEqual(config.Barriers, []string{"k8s.io/kubernetes/pkg/scheduler/util"}) {
+		t.Errorf("barriers should be overridden, but %v actually", config.Barriers)
+	}
+	if !reflect.DeepEqual(config.Packages, []string{"k8s.io/kubernetes/pkg/scheduler"}) || len(config.Readers) != 1 {
+		t.Errorf("packages and readers should be the ones of the profile, but %v and %v actually", config.Packages, config.Readers)
+	}
+
+	if config, err = loadConfig("", ""); err != nil || config.Profile != "" || len(config.Packages) != 0 {
+		t.Errorf("the config should be empty without a profile, but %+v actually", config)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	// the flags override the config
+	config := writeConfig(t, "profile: scheduler\n")
+	var out, errOut bytes.Buffer
+	if code := run([]string{"collect", "-config", config, "-pkg", testdataPkg}, &out, &errOut); code != exitOK {
+		t.Fatalf("exit code should be %d, but %d actually: %s", exitOK, code, errOut.String())
+	}
+	if !strings.Contains(out.String(), "AddEventHandler Add: (*"+testdataPkg+".Controller).addPod$bound#Add") {
+		t.Errorf("addPod should be collected, but the output is:\n%s", out.String())
+	}
+}
+
+func TestPackagePatterns(t *testing.T) {
+	// a directory matches the import path of its package
+	var out, errOut bytes.Buffer
+	if code := run([]string{"collect", "-pkg", "./ssapasses/tracker/testdata"}, &out, &errOut); code != exitOK {
+		t.Fatalf("exit code should be %d, but %d actually: %s", exitOK, code, errOut.String())
+	}
+	if !strings.Contains(out.String(), "(*"+testdataPkg+".Controller).addPod$bound#Add") {
+		t.Errorf("addPod should be collected, but the output is:\n%s", out.String())
+	}
+	// a pattern with ... matches several packages, the testdata excluded
+	if code := run([]string{"graph", "-pkg", "./ssapasses/..."}, &out, &errOut); code != exitError ||
+		!strings.Contains(errOut.String(), "graph takes one package") {
+		t.Errorf("graph of several packages should fail, but %d %q actually", code, errOut.String())
+	}
+	errOut.Reset()
+	if code := run([]string{"collect", "-pkg", "./ssapasses/tracker/testdata/..."}, &out, &errOut); code != exitError ||
+		!strings.Contains(errOut.String(), "no packages match") {
+		t.Errorf("a pattern matching nothing should fail, but %d %q actually", code, errOut.String())
+	}
+}
+
+func TestCheckPackages(t *testing.T) {
+	// the checkers run on each package, and the SARIF run holds the chains of all of them
+	var out, errOut bytes.Buffer
+	args := []string{"check", "-pkg", "./ssapasses/checker/testdata/requeue", "-pkg", "./ssapasses/tracker/testdata", "-output", "sarif"}
+	if code := run(args, &out, &errOut); code != exitFindings {
+		t.Fatalf("exit code should be %d, but %d actually: %s", exitFindings, code, errOut.String())
+	}
+	for _, expected := range []string{`"ruleId": "lostupdate"`, `"ruleId": "sideeffect"`, `"uri": "ssapasses/tracker/testdata/workqueue.go"`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("the SARIF log should contain %s, but it is:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestDiffExitCode(t *testing.T) {
+	var old, errOut bytes.Buffer
+	if code := run([]string{"graph", "-pkg", testdataPkg}, &old, &errOut); code != exitOK {
+		t.Fatalf("exit code should be %d, but %d actually: %s", exitOK, code, errOut.String())
+	}
+	var new bytes.Buffer
+	run([]string{"graph", "-pkg", testdataPkg, "-handler", "addPod"}, &new, &errOut)
+	oldPath, newPath := writeConfig(t, old.String()), writeConfig(t, new.String())
+
+	var out bytes.Buffer
+	if code := run([]string{"diff", oldPath, oldPath}, &out, &errOut); code != exitOK || out.Len() != 0 {
+		t.Errorf("the same graphs should not differ, but exit code %d and:\n%s", code, out.String())
+	}
+	if code := run([]string{"diff", oldPath, newPath}, &out, &errOut); code != exitFindings {
+		t.Errorf("exit code should be %d, but %d actually", exitFindings, code)
+	}
+	// the Requeue trigger processNextWorkItem is not in the graph of addPod
+	if !strings.Contains(out.String(), "- handler handler:(*"+testdataPkg+".Controller).processNextWorkItem#Requeue") {
+		t.Errorf("the Requeue trigger should be removed, but the diff is:\n%s", out.String())
+	}
+}
+
+func TestBuildFlagErrors(t *testing.T) {
+	var out, errOut bytes.Buffer
+	args := []string{"collect", "-pkg", "kubetorch/ssapasses/tracker/testdata", "-goos", "Linux", "-env", "CGO_ENABLED"}
+	if code := run(args, &out, &errOut); code != exitUsage {
+		t.Errorf("exit code should be %d, but %d actually", exitUsage, code)
+	}
+	expected := "kubetorch: flag -goos: invalid GOOS \"Linux\"\n" +
+		"kubetorch: flag -env: invalid variable \"CGO_ENABLED\", expected KEY=VALUE\n"
+	if errOut.String() != expected {
+		t.Errorf("errors should be\n%s\nbut\n%s\nactually", expected, errOut.String())
+	}
+}
@@ -1,7 +1,7 @@
 go get -u golang.org/x/tools/go/packages
 go get -u golang.org/x/tools/go/ssa
 go get -u github.com/golang-collections/go-datastructures/queue
-go get -u gopkg.in/yaml.v2
+go get -u gopkg.in/yaml.v3
 
 wget https://dl.k8s.io/v1.18.0/kubernetes-src.tar.gz
 mkdir -p $GOPATH/src/k8s.io/kubernetes
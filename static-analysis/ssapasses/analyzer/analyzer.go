@@ -0,0 +1,168 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+// Package analyzer runs the collector, the tracker and the checkers on packages and
+// returns their results, so that kubetorch can be used as a library.
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/checker"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+)
+
+// Options are the packages to analyze, the models of the analysis and what to compute.
+type Options struct {
+	// Packages are the package patterns to analyze, e.g. "./pkg/...", loaded together with
+	// the Load config. There is a component per package matched.
+	Packages []string
+	Load     collector.LoadConfig
+
+	// Registrars are the functions searched for registrations, all the functions of the
+	// packages when empty. RegistrationAPIs default to collector.DefaultRegistrationAPIs.
+	Registrars       []string
+	RegistrationAPIs []string
+	Filter           collector.Filter
+
+	// The models added to the defaults of the tracker.
+	Barriers     []string
+	Sanitizers   []string
+	PayloadSinks map[string]tracker.Sink
+	MethodSinks  map[string]tracker.Sink
+	Readers      []tracker.Reader
+	Containers   []tracker.Container
+	Budgets      tracker.Budgets
+	ImplicitFlow bool
+
+	// Chains tracks the entry points, StaleReads tracks the cache reads.
+	Chains     bool
+	StaleReads bool
+	// Checks are the checkers run on each package, see checker.Names.
+	Checks []string
+	// Conflicts reports the write-write conflicts between the packages.
+	Conflicts bool
+}
+
+// Component is the result of the analysis of one package.
+type Component struct {
+	Package   string
+	Collector *collector.Collector
+	Tracker   *tracker.Tracker
+	Checker   *checker.Checker
+	// Entries are the entry points collected, by position.
+	Entries []collector.Entry
+	// Chains are the chains of the entry points when Options.Chains is set.
+	Chains []tracker.Chain
+	// StaleReads are the cache reads flowing into sinks when Options.StaleReads is set.
+	StaleReads []tracker.StaleRead
+	// Findings are the findings of Options.Checks, by position.
+	Findings []checker.Finding
+}
+
+// Result is the result of the analysis.
+type Result struct {
+	Prog       *ssa.Program
+	Components []*Component
+	// Conflicts are the write-write conflicts between the components when Options.Conflicts is set.
+	Conflicts []checker.Finding
+}
+
+// Diagnostics returns the constructs skipped by the collectors and the trackers. The
+// trackers also skip constructs when the result is used, e.g. by a graph, so the
+// diagnostics are read once it has been.
+func (r *Result) Diagnostics() []collector.Diagnostic {
+	diagnostics := []collector.Diagnostic{}
+	for _, c := range r.Components {
+		diagnostics = append(diagnostics, c.Collector.Diagnostics()...)
+		diagnostics = append(diagnostics, c.Tracker.Diagnostics()...)
+	}
+	return diagnostics
+}
+
+// Findings returns the findings of all the components followed by the conflicts.
+func (r *Result) Findings() []checker.Finding {
+	findings := []checker.Finding{}
+	for _, c := range r.Components {
+		findings = append(findings, c.Findings...)
+	}
+	return append(findings, r.Conflicts...)
+}
+
+// Analyze loads the packages and analyzes each of them. The loading errors, the
+// unknown checkers and the cancellation of ctx are returned, as well as an error when
+// no package is given: loading no pattern would load the package of the current directory.
+func Analyze(ctx context.Context, opts Options) (*Result, error) {
+	if len(opts.Packages) == 0 {
+		return nil, errors.New("no package to analyze")
+	}
+	prog, paths, err := collector.LoadPackages(ctx, opts.Load, opts.Packages...)
+	if ctx.Err() != nil {
+		// the loading errors of a cancellation wrap the error of ctx
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Prog: prog}
+	checkers := []*checker.Checker{}
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c := collector.NewCollector(path)
+		c.SetRegistrars(opts.Registrars...)
+		if len(opts.RegistrationAPIs) != 0 {
+			c.SetRegistrationAPIs(opts.RegistrationAPIs...)
+		}
+		c.SetFilter(opts.Filter)
+		c.SetLoadConfig(opts.Load)
+		c.Collect(prog)
+
+		t := newTracker(c, opts)
+		component := &Component{
+			Package:   path,
+			Collector: c,
+			Tracker:   t,
+			Checker:   checker.NewChecker(c, t),
+			Entries:   c.Entries(),
+		}
+		if opts.Chains {
+			for _, entry := range component.Entries {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				component.Chains = append(component.Chains, t.Chain(entry))
+			}
+		}
+		if opts.StaleReads {
+			component.StaleReads = t.StaleReads()
+		}
+		if component.Findings, err = component.Checker.Check(opts.Checks...); err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, component.Checker)
+		result.Components = append(result.Components, component)
+	}
+	if opts.Conflicts && len(checkers) > 1 {
+		result.Conflicts = checker.Conflicts(checkers...)
+	}
+	return result, nil
+}
+
+// newTracker returns the tracker of the collector with the models of the options.
+func newTracker(c *collector.Collector, opts Options) *tracker.Tracker {
+	t := tracker.NewTracker(c)
+	t.SetImplicitFlow(opts.ImplicitFlow)
+	t.AddBarriers(opts.Barriers...)
+	t.AddSanitizers(opts.Sanitizers...)
+	t.AddPayloadSinks(opts.PayloadSinks)
+	t.AddMethodSinks(opts.MethodSinks)
+	t.AddReaders(opts.Readers...)
+	t.AddContainers(opts.Containers...)
+	t.SetBudgets(opts.Budgets)
+	return t
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package analyzer
+
+import (
+	"context"
+	"kubetorch/ssapasses/tracker"
+	"reflect"
+	"testing"
+)
+
+const testdataPkg = "kubetorch/ssapasses/tracker/testdata"
+
+func TestAnalyze(t *testing.T) {
+	result, err := Analyze(context.Background(), Options{
+		Packages: []string{testdataPkg},
+		Chains:   true,
+		Checks:   []string{"lostupdate"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Components) != 1 {
+		t.Fatalf("components len should be 1, but %d actually", len(result.Components))
+	}
+	component := result.Components[0]
+	entries := []string{}
+	for _, e := range component.Entries {
+		entries = append(entries, e.Event+" "+e.Handler.Name())
+	}
+	if expected := []string{"Add addPod$bound", "Requeue processNextWorkItem"}; !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries should be %v, but %v actually", expected, entries)
+	}
+
+	// addPod -> queue.Add(key) -> queue.Get() -> syncPod -> UpdateStatus
+	if len(component.Chains) != 2 {
+		t.Fatalf("chains len should be 2, but %d actually", len(component.Chains))
+	}
+	chain := component.Chains[0]
+	sink := tracker.Sink{Resource: "Pod", Part: tracker.PartStatus}
+	if chain.Handler.Name() != "addPod$bound" || len(chain.Hits) != 1 || chain.Hits[0].Sink != sink {
+		t.Errorf("addPod should reach %v, but %v actually", sink, chain.Hits)
+	}
+	if len(component.StaleReads) != 0 {
+		t.Errorf("stale reads should not be tracked, but %d found", len(component.StaleReads))
+	}
+	for _, f := range result.Findings() {
+		if f.Checker != "lostupdate" {
+			t.Errorf("only lostupdate should run, but %s found", f.Checker)
+		}
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	if _, err := Analyze(context.Background(), Options{}); err == nil {
+		t.Error("no package should be an error")
+	}
+	if _, err := Analyze(context.Background(), Options{Packages: []string{testdataPkg + "/missing"}}); err == nil {
+		t.Error("a package matching nothing should be an error")
+	}
+	if _, err := Analyze(context.Background(), Options{Packages: []string{testdataPkg}, Checks: []string{"races"}}); err == nil {
+		t.Error("an unknown checker should be an error")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Analyze(ctx, Options{Packages: []string{testdataPkg}}); err != context.Canceled {
+		t.Errorf("the error should be %v, but %v actually", context.Canceled, err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	result, err := Analyze(context.Background(), Options{
+		Packages: []string{"kubetorch/ssapasses/collector/testdata/malformed"},
+		Chains:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the handlers skipped by the collector, and the call of reset skipped by the tracker
+	diagnostics := result.Diagnostics()
+	if len(diagnostics) != 4 {
+		t.Fatalf("diagnostics len should be 4, but %d actually: %v", len(diagnostics), diagnostics)
+	}
+	if d := diagnostics[3]; d.Function != "(*kubetorch/ssapasses/collector/testdata/malformed.controller).addHandler" || d.Position.Line != 43 {
+		t.Errorf("the diagnostic should be in addHandler at line 43, but %v actually", d)
+	}
+	if chains := result.Components[0].Chains; len(chains) != 1 || chains[0].Handler.Name() != "addHandler$bound" {
+		t.Errorf("the chain of addHandler should be tracked, but %v actually", chains)
+	} else if written := chains[0].Written; len(written) != 1 || tracker.FieldName(written[0].X, written[0].Field) != "items" {
+		t.Errorf("addHandler should write items, but %v actually", written)
+	}
+}
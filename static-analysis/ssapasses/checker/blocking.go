@@ -0,0 +1,249 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package checker
+
+import (
+	"fmt"
+	"go/constant"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/tracker"
+	"strings"
+)
+
+// callStep is a call on the path from a handler to a blocking operation.
+type callStep struct {
+	site   ssa.CallInstruction
+	callee *ssa.Function
+}
+
+// displayName returns the name of fn as written in the source.
+func displayName(fn *ssa.Function) string {
+	return strings.TrimSuffix(fn.Name(), "$bound")
+}
+
+// mutexOp returns the operation of the call on a sync.Mutex or sync.RWMutex,
+// e.g. "Lock", and the mutex locked, if any.
+func mutexOp(common *ssa.CallCommon) (string, ssa.Value) {
+	callee := common.StaticCallee()
+	if callee == nil || callee.Signature.Recv() == nil || len(common.Args) == 0 {
+		return "", nil
+	}
+	recv := tracker.DerefType(callee.Signature.Recv().Type()).String()
+	if recv != "sync.Mutex" && recv != "sync.RWMutex" {
+		return "", nil
+	}
+	switch callee.Name() {
+	case "Lock", "RLock", "Unlock", "RUnlock":
+		return callee.Name(), common.Args[0]
+	}
+	return "", nil
+}
+
+// sameMutex tells whether a and b are the same mutex, e.g. two loads of &c.mu.
+func sameMutex(a, b ssa.Value) bool {
+	if a == b {
+		return true
+	}
+	fa, okA := a.(*ssa.FieldAddr)
+	fb, okB := b.(*ssa.FieldAddr)
+	return okA && okB && fa.Field == fb.Field && sameMutex(fa.X, fb.X)
+}
+
+// chanSizes records the buffer sizes of the channels stored into fields, e.g. c.events = make(chan string).
+// A field holding channels of different sizes is recorded with -1.
+func (c *Checker) chanSizes() map[tracker.FieldKey]int64 {
+	sizes := map[tracker.FieldKey]int64{}
+	for _, fun := range c.packageFunctions() {
+		for _, block := range fun.Blocks {
+			for _, instr := range block.Instrs {
+				st, ok := instr.(*ssa.Store)
+				if !ok {
+					continue
+				}
+				fa, okFA := st.Addr.(*ssa.FieldAddr)
+				mc, okMC := st.Val.(*ssa.MakeChan)
+				if !okFA || !okMC {
+					continue
+				}
+				size := bufferSize(mc)
+				if prev, found := sizes[tracker.KeyOf(fa)]; found && prev != size {
+					size = -1
+				}
+				sizes[tracker.KeyOf(fa)] = size
+			}
+		}
+	}
+	return sizes
+}
+
+// bufferSize returns the constant buffer size of the channel made, or -1.
+func bufferSize(mc *ssa.MakeChan) int64 {
+	if size, ok := mc.Size.(*ssa.Const); ok {
+		if n, exact := constant.Int64Val(constant.ToInt(size.Value)); exact {
+			return n
+		}
+	}
+	return -1
+}
+
+// isUnbuffered tells whether the channel is known to be unbuffered.
+func isUnbuffered(ch ssa.Value, sizes map[tracker.FieldKey]int64) bool {
+	switch ch.(type) {
+	case *ssa.MakeChan:
+		return bufferSize(ch.(*ssa.MakeChan)) == 0
+	case *ssa.UnOp:
+		if fa, ok := ch.(*ssa.UnOp).X.(*ssa.FieldAddr); ok {
+			size, found := sizes[tracker.KeyOf(fa)]
+			return found && size == 0
+		}
+	}
+	return false
+}
+
+// heldAcross returns the first call made while the mutex locked by instr is held, if any.
+// The mutex is held until it is unlocked on every path, and until the return with a deferred Unlock.
+// Only the calls of unknown duration are considered: the dynamic calls and the calls to the package.
+func (c *Checker) heldAcross(instr ssa.CallInstruction, mutex ssa.Value) ssa.CallInstruction {
+	block := instr.Block()
+	start := 0
+	for i, in := range block.Instrs {
+		if in == instr {
+			start = i + 1
+		}
+	}
+	visited := map[*ssa.BasicBlock]struct{}{}
+	var walk func(b *ssa.BasicBlock, from int) ssa.CallInstruction
+	walk = func(b *ssa.BasicBlock, from int) ssa.CallInstruction {
+		for _, in := range b.Instrs[from:] {
+			call, ok := in.(*ssa.Call)
+			if !ok {
+				continue
+			}
+			if op, m := mutexOp(call.Common()); op != "" {
+				if (op == "Unlock" || op == "RUnlock") && sameMutex(m, mutex) {
+					return nil
+				}
+				continue
+			}
+			if callee := call.Common().StaticCallee(); callee == nil || c.inPackage(callee) {
+				if _, builtin := call.Common().Value.(*ssa.Builtin); !builtin {
+					return call
+				}
+			}
+		}
+		for _, succ := range b.Succs {
+			if _, found := visited[succ]; found {
+				continue
+			}
+			visited[succ] = struct{}{}
+			if call := walk(succ, 0); call != nil {
+				return call
+			}
+		}
+		return nil
+	}
+	return walk(block, start)
+}
+
+// blockingOps returns the blocking operations of fn with a description.
+func (c *Checker) blockingOps(fn *ssa.Function, sizes map[tracker.FieldKey]int64) map[ssa.Instruction]string {
+	ops := map[ssa.Instruction]string{}
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			switch instr.(type) {
+			case *ssa.Send:
+				if isUnbuffered(instr.(*ssa.Send).Chan, sizes) {
+					ops[instr] = "send on an unbuffered channel"
+				}
+			case *ssa.Call:
+				call := instr.(*ssa.Call)
+				common := call.Common()
+				if sink, found := c.tracker.CallSink(common); found {
+					ops[instr] = fmt.Sprintf("API call %s writing %s", calleeName(common), sink)
+					continue
+				}
+				if op, mutex := mutexOp(common); op == "Lock" || op == "RLock" {
+					if across := c.heldAcross(call, mutex); across != nil {
+						ops[instr] = fmt.Sprintf("lock held across a call to %s", calleeName(across.Common()))
+					}
+					continue
+				}
+				callee := common.StaticCallee()
+				if callee == nil {
+					continue
+				}
+				switch callee.String() {
+				case "time.Sleep":
+					ops[instr] = "call to time.Sleep"
+				case "(*sync.WaitGroup).Wait":
+					ops[instr] = "call to sync.WaitGroup.Wait"
+				}
+			}
+		}
+	}
+	return ops
+}
+
+func calleeName(common *ssa.CallCommon) string {
+	if common.IsInvoke() {
+		return common.Method.Name()
+	}
+	if callee := common.StaticCallee(); callee != nil {
+		return displayName(callee)
+	}
+	return common.Value.Name()
+}
+
+// CheckBlocking reports the blocking operations executed by the handlers: they run on the
+// notification goroutine of the shared informer and stall every other handler.
+// The transitive callees declared in the package are walked, and each finding shows the call path.
+func (c *Checker) CheckBlocking() []Finding {
+	findings := []Finding{}
+	sizes := c.chanSizes()
+	for call, handlers := range c.handlerMap {
+		for event, handler := range handlers {
+			visited := map[*ssa.Function]struct{}{handler: {}}
+			var walk func(fn *ssa.Function, path []callStep)
+			walk = func(fn *ssa.Function, path []callStep) {
+				for instr, op := range c.blockingOps(fn, sizes) {
+					related := []Location{{Pos: call.Pos(), Note: fmt.Sprintf("the %s handler %s is registered here", event, displayName(handler))}}
+					for _, step := range path {
+						// the wrapper of a bound method just calls the method
+						if step.site.Parent().Synthetic == "" {
+							related = append(related, Location{Pos: step.site.Pos(), Note: fmt.Sprintf("%s calls %s",
+								displayName(step.site.Parent()), displayName(step.callee))})
+						}
+					}
+					findings = append(findings, Finding{
+						Checker:      "blocking",
+						Pos:          instr.Pos(),
+						Message:      fmt.Sprintf("handler %s may block: %s in %s", displayName(handler), op, displayName(fn)),
+						Related:      related,
+						Registration: call.Pos(),
+					})
+				}
+				for _, block := range fn.Blocks {
+					for _, instr := range block.Instrs {
+						site, ok := instr.(*ssa.Call)
+						if !ok {
+							continue
+						}
+						callee := site.Common().StaticCallee()
+						if callee == nil || len(callee.Blocks) == 0 || !c.inPackage(callee) {
+							continue
+						}
+						if _, found := visited[callee]; found {
+							continue
+						}
+						visited[callee] = struct{}{}
+						walk(callee, append(append([]callStep{}, path...), callStep{site: site, callee: callee}))
+					}
+				}
+			}
+			walk(handler, nil)
+		}
+	}
+	return findings
+}
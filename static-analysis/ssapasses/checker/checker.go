@@ -0,0 +1,167 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package checker
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"io"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+	"os"
+	"sort"
+)
+
+// Location is a position related to a finding, e.g. the read of the object mutated.
+type Location struct {
+	Pos  token.Pos
+	Note string
+}
+
+// Finding is a bug pattern reported by a checker.
+type Finding struct {
+	// Checker is the name of the checker reporting the finding, e.g. "deepcopy".
+	Checker string
+	// Pos is where the problem is, e.g. the mutation of a cached object.
+	Pos     token.Pos
+	Message string
+	// Related lists the other positions involved, e.g. where the object is read.
+	Related []Location
+	// Registration is where the handler the finding is reached from is registered, if known.
+	Registration token.Pos
+}
+
+type Checker struct {
+	pattern    string
+	prog       *ssa.Program
+	handlerMap map[*ssa.Call]map[string]*ssa.Function
+	triggerMap map[ssa.CallInstruction]map[string]*ssa.Function
+	tracker    *tracker.Tracker
+	// sites are the call sites of the functions of the package, see lostupdate.go
+	sites map[*ssa.Function][]*ssa.Call
+}
+
+// checks maps the name of each checker to its implementation.
+var checks = map[string]func(c *Checker) []Finding{
+	"deepcopy":    (*Checker).CheckDeepCopy,
+	"tombstone":   (*Checker).CheckTombstones,
+	"blocking":    (*Checker).CheckBlocking,
+	"lockset":     (*Checker).CheckLocksets,
+	"idempotency": (*Checker).CheckIdempotency,
+	"lostupdate":  (*Checker).CheckLostUpdates,
+}
+
+// Names returns the names of all the checkers.
+func Names() []string {
+	names := []string{}
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check runs the checkers named and returns their findings sorted by position.
+func (c *Checker) Check(names ...string) ([]Finding, error) {
+	findings := []Finding{}
+	for _, name := range names {
+		check, ok := checks[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown checker %q, available: %v", name, Names())
+		}
+		findings = append(findings, check(c)...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Pos < findings[j].Pos })
+	return findings, nil
+}
+
+// Print prints the findings with their positions.
+func (c *Checker) Print(findings []Finding) {
+	c.Fprint(os.Stdout, findings)
+}
+
+// Fprint writes the findings with their positions to w.
+func (c *Checker) Fprint(w io.Writer, findings []Finding) {
+	for _, f := range findings {
+		fmt.Fprintf(w, "%v: [%s] %s\n", c.prog.Fset.Position(f.Pos), f.Checker, f.Message)
+		for _, r := range f.Related {
+			fmt.Fprintf(w, "    %v: %s\n", c.prog.Fset.Position(r.Pos), r.Note)
+		}
+	}
+}
+
+// packageFunctions returns the functions of the package analyzed.
+func (c *Checker) packageFunctions() []*ssa.Function {
+	funs := []*ssa.Function{}
+	if pkg := collector.PackageOf(c.prog, c.pattern); pkg != nil {
+		funs = append(funs, collector.PackageFunctions(c.prog, pkg)...)
+	}
+	return funs
+}
+
+// inPackage tells whether fn is declared in the package analyzed.
+func (c *Checker) inPackage(fn *ssa.Function) bool {
+	if fn.Pkg == nil && fn.Parent() != nil {
+		return c.inPackage(fn.Parent())
+	}
+	return fn.Pkg != nil && fn.Pkg.Pkg.Path() == c.pattern
+}
+
+// aliases returns v and the values standing for it: conversions, Phis, and the
+// parameters of the functions of the package it is passed to.
+func (c *Checker) aliases(v ssa.Value) []ssa.Value {
+	found := map[ssa.Value]struct{}{v: {}}
+	result := []ssa.Value{}
+	worklist := []ssa.Value{v}
+	add := func(alias ssa.Value) {
+		if _, ok := found[alias]; !ok {
+			found[alias] = struct{}{}
+			worklist = append(worklist, alias)
+		}
+	}
+	for len(worklist) != 0 {
+		cur := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		result = append(result, cur)
+		if cur.Referrers() == nil {
+			continue
+		}
+		for _, ref := range *cur.Referrers() {
+			switch ref.(type) {
+			case *ssa.ChangeType, *ssa.MakeInterface, *ssa.Phi:
+				add(ref.(ssa.Value))
+			case *ssa.Call:
+				common := ref.(*ssa.Call).Common()
+				callee := common.StaticCallee()
+				if callee == nil || len(callee.Blocks) == 0 || !c.inPackage(callee) {
+					continue
+				}
+				for i, arg := range common.Args {
+					if arg == cur && i < len(callee.Params) {
+						add(callee.Params[i])
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// typeName returns typ qualified by the package names only, e.g. "*v1.Pod".
+func typeName(typ types.Type) string {
+	return types.TypeString(typ, func(p *types.Package) string { return p.Name() })
+}
+
+func NewChecker(c *collector.Collector, t *tracker.Tracker) *Checker {
+	return &Checker{
+		pattern:    c.GetPattern(),
+		prog:       c.GetProg(),
+		handlerMap: c.GetHandlerMap(),
+		triggerMap: c.GetTriggerMap(),
+		tracker:    t,
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package checker
+
+import (
+	"context"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testdataPkg = "kubetorch/ssapasses/checker/testdata"
+
+var (
+	loadOnce sync.Once
+	loaded   *collector.Collector
+)
+
+// newTestChecker returns a fresh checker over the testdata, which is loaded only once.
+func newTestChecker() *Checker {
+	loadOnce.Do(func() {
+		loaded = collector.NewCollector(testdataPkg)
+		loaded.CollectEntryPoints()
+	})
+	return NewChecker(loaded, tracker.NewTracker(loaded))
+}
+
+// messages runs the checker named and returns the messages of its findings, sorted.
+func messages(t *testing.T, name string) []string {
+	findings, err := newTestChecker().Check(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []string{}
+	for _, f := range findings {
+		msgs = append(msgs, f.Message)
+	}
+	sort.Strings(msgs)
+	return msgs
+}
+
+func TestUnknownChecker(t *testing.T) {
+	if _, err := newTestChecker().Check("unknown"); err == nil {
+		t.Error("an unknown checker should be an error")
+	}
+}
+
+func TestDeepCopy(t *testing.T) {
+	expected := []string{
+		"cur.Status.Phase is mutated without DeepCopy in updatePod",
+		"obj.ObjectMeta.Labels is mutated without DeepCopy in setLabel",
+		"obj[].Spec.NodeName is mutated without DeepCopy in unbindPods",
+	}
+	if msgs := messages(t, "deepcopy"); !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("findings should be %v, but %v actually", expected, msgs)
+	}
+}
+
+func TestTombstones(t *testing.T) {
+	findings, err := newTestChecker().Check("tombstone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"Delete handler deleteNode asserts obj to *v1.Node without handling cache.DeletedFinalStateUnknown: it panics on a tombstone",
+		"Delete handler forgetPod asserts obj to *v1.Pod without handling cache.DeletedFinalStateUnknown: it misses the deletions on a tombstone",
+	}
+	msgs := []string{}
+	for _, f := range findings {
+		msgs = append(msgs, f.Message)
+	}
+	sort.Strings(msgs)
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("findings should be %v, but %v actually", expected, msgs)
+	}
+	// the informer kind is found from the registration
+	notes := map[string]struct{}{}
+	for _, f := range findings {
+		notes[f.Related[0].Note] = struct{}{}
+	}
+	for _, kind := range []string{"Node", "Pod"} {
+		if _, found := notes["the handler is registered for the "+kind+" informer here"]; !found {
+			t.Errorf("the %s informer should be reported, but %v actually", kind, notes)
+		}
+	}
+}
+
+func TestBlocking(t *testing.T) {
+	findings, err := newTestChecker().Check("blocking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"handler addNode may block: call to time.Sleep in recordNode",
+		"handler addNode may block: send on an unbuffered channel in recordNode",
+		"handler updateNode may block: API call Delete writing Pod object in updateNode",
+		"handler updateNode may block: call to sync.WaitGroup.Wait in updateNode",
+		"handler updateNode may block: lock held across a call to Delete in updateNode",
+	}
+	msgs := []string{}
+	for _, f := range findings {
+		msgs = append(msgs, f.Message)
+	}
+	sort.Strings(msgs)
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("findings should be %v, but %v actually", expected, msgs)
+	}
+	// the call path goes through recordNode
+	for _, f := range findings {
+		if strings.HasSuffix(f.Message, "in recordNode") {
+			last := f.Related[len(f.Related)-1]
+			if last.Note != "addNode calls recordNode" {
+				t.Errorf("the call path should end with addNode calls recordNode, but %v actually", f.Related)
+			}
+		}
+	}
+}
+
+func TestLocksets(t *testing.T) {
+	expected := []string{
+		"Controller.lastNode is written by handler deleteNode and read by handler forgetPod with no common lock",
+		"Controller.lastNode is written by handler deleteNode and read by worker worker with no common lock",
+	}
+	if msgs := messages(t, "lockset"); !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("findings should be %v, but %v actually", expected, msgs)
+	}
+}
+
+func TestRequeuedConflicts(t *testing.T) {
+	c := collector.NewCollector(testdataPkg + "/requeue")
+	c.CollectEntryPoints()
+	findings, err := NewChecker(c, tracker.NewTracker(c)).Check("lostupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the conflicts returned to the requeuing worker are handled
+	expected := []string{"finishPod reads a Pod from the cache, modifies it and calls UpdateStatus without conflict handling"}
+	msgs := []string{}
+	for _, f := range findings {
+		msgs = append(msgs, f.Message)
+	}
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("findings should be %v, but %v actually", expected, msgs)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	expected := []string{
+		"Update handler labelPod calls Add on a workqueue even when old == new: no early return on ResourceVersion, Generation or DeepEqual",
+		"Update handler relabelPod calls Add on a workqueue even when old == new: no early return on ResourceVersion, Generation or DeepEqual",
+		"Update handler updateNode calls Delete writing Pod object even when old == new: no early return on ResourceVersion, Generation or DeepEqual",
+		"Update handler updatePod writes Phase even when old == new: no early return on ResourceVersion, Generation or DeepEqual",
+	}
+	if msgs := messages(t, "idempotency"); !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("findings should be %v, but %v actually", expected, msgs)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	collectors, err := collector.CollectComponents(context.Background(), collector.LoadConfig{}, testdataPkg, testdataPkg+"/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkers := []*Checker{}
+	for _, c := range collectors {
+		checkers = append(checkers, NewChecker(c, tracker.NewTracker(c)))
+	}
+	findings := Conflicts(checkers...)
+	if len(findings) != 2 {
+		t.Fatalf("conflicts len should be 2, but %d actually", len(findings))
+	}
+	notes := []string{}
+	for _, f := range findings {
+		if f.Message != "write-write conflict on Pod object between "+testdataPkg+" and "+testdataPkg+"/other" {
+			t.Errorf("unexpected conflict %s", f.Message)
+		}
+		notes = append(notes, f.Related[1].Note)
+	}
+	sort.Strings(notes)
+	expected := []string{
+		testdataPkg + "/other: Add handler addPod of the Pod informer writes Pod object, with resourceVersion precondition, without retry.RetryOnConflict",
+		testdataPkg + "/other: Update handler updatePod of the Pod informer writes Pod object, without resourceVersion precondition, with retry.RetryOnConflict",
+	}
+	if !reflect.DeepEqual(notes, expected) {
+		t.Errorf("the other side should be %v, but %v actually", expected, notes)
+	}
+	side := testdataPkg + ": Update handler updateNode of the Node informer writes Pod object, without resourceVersion precondition, without retry.RetryOnConflict"
+	if findings[0].Related[0].Note != side {
+		t.Errorf("the first side should be %s, but %s actually", side, findings[0].Related[0].Note)
+	}
+}
+
+func TestLostUpdates(t *testing.T) {
+	findings, err := newTestChecker().Check("lostupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"patchFromCache patches a Pod with a body marshaled from the full object read from the cache",
+		"syncLabels reads a Pod from the cache, modifies it and calls Update without conflict handling",
+		"syncPod reads a Pod from the cache, modifies it and calls UpdateStatus without conflict handling",
+		"unbindPods reads a Pod from the cache, modifies it and calls Update without conflict handling",
+	}
+	msgs := []string{}
+	for _, f := range findings {
+		msgs = append(msgs, f.Message)
+	}
+	sort.Strings(msgs)
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("findings should be %v, but %v actually", expected, msgs)
+	}
+	// the witness chain goes from the read to the write through the helper modifying the object
+	for _, f := range findings {
+		if !strings.HasPrefix(f.Message, "syncLabels") {
+			continue
+		}
+		notes := []string{}
+		for _, r := range f.Related {
+			notes = append(notes, r.Note)
+		}
+		chain := []string{
+			"the object is read from the informer cache here",
+			"the object is modified in setLabel",
+			"Update writes Pod spec without conflict handling",
+		}
+		if !reflect.DeepEqual(notes, chain) {
+			t.Errorf("witness should be %v, but %v actually", chain, notes)
+		}
+	}
+}
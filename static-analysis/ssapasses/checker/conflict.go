@@ -0,0 +1,170 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package checker
+
+import (
+	"fmt"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+	"sort"
+	"strings"
+)
+
+// entrySink is a sink reached from an entry point of a controller.
+type entrySink struct {
+	controller string
+	// trigger describes the event leading to the sink, e.g. "Add handler addPod of the Pod informer".
+	trigger string
+	instr   ssa.Instruction
+	sink    tracker.Sink
+	// fields are the fields set by a Patch body, if known.
+	fields []string
+}
+
+// reachable returns fn and the functions of the package it may call, including the
+// closures it creates, e.g. the one passed to retry.RetryOnConflict.
+func (c *Checker) reachable(fn *ssa.Function) []*ssa.Function {
+	visited := map[*ssa.Function]struct{}{fn: {}}
+	funs := []*ssa.Function{fn}
+	for i := 0; i < len(funs); i++ {
+		for _, block := range funs[i].Blocks {
+			for _, instr := range block.Instrs {
+				var callee *ssa.Function
+				switch instr.(type) {
+				case ssa.CallInstruction:
+					callee = instr.(ssa.CallInstruction).Common().StaticCallee()
+				case *ssa.MakeClosure:
+					callee, _ = instr.(*ssa.MakeClosure).Fn.(*ssa.Function)
+				}
+				if callee == nil || len(callee.Blocks) == 0 || !c.inPackage(callee) {
+					continue
+				}
+				if _, found := visited[callee]; !found {
+					visited[callee] = struct{}{}
+					funs = append(funs, callee)
+				}
+			}
+		}
+	}
+	return funs
+}
+
+// entrySinks returns the sinks reached from each entry point: the API calls of the
+// entry point and its callees, and the sinks the tracker reaches from its writes.
+func (c *Checker) entrySinks() []entrySink {
+	sinks := []entrySink{}
+	add := func(entry *ssa.Function, trigger string) {
+		seen := map[ssa.Instruction]struct{}{}
+		record := func(instr ssa.Instruction, sink tracker.Sink) {
+			if _, found := seen[instr]; found {
+				return
+			}
+			seen[instr] = struct{}{}
+			es := entrySink{controller: c.pattern, trigger: trigger, instr: instr, sink: sink}
+			if call, ok := instr.(*ssa.Call); ok {
+				es.fields = tracker.PayloadFields(call)
+			}
+			sinks = append(sinks, es)
+		}
+		for _, fn := range c.reachable(entry) {
+			for _, block := range fn.Blocks {
+				for _, instr := range block.Instrs {
+					if call, ok := instr.(*ssa.Call); ok {
+						if sink, found := c.tracker.CallSink(call.Common()); found {
+							record(call, sink)
+						}
+					}
+				}
+			}
+		}
+		hits, _ := c.tracker.SinksFrom(entry)
+		for _, hit := range hits {
+			record(hit.Instr, hit.Sink)
+		}
+	}
+	for call, handlers := range c.handlerMap {
+		kind := collector.InformerKind(call)
+		for event, handler := range handlers {
+			add(handler, fmt.Sprintf("%s handler %s of the %s informer", event, displayName(handler), kind))
+		}
+	}
+	for _, triggers := range c.triggerMap {
+		for trigger, fn := range triggers {
+			add(fn, fmt.Sprintf("%s trigger %s", strings.ToLower(trigger), displayName(fn)))
+		}
+	}
+	return sinks
+}
+
+// sameFieldGroup tells whether the two sinks write the same part of the same resource.
+// When the fields patched are known on both sides, they must overlap too.
+func sameFieldGroup(a, b entrySink) bool {
+	if a.sink != b.sink {
+		return false
+	}
+	if len(a.fields) == 0 || len(b.fields) == 0 {
+		return true
+	}
+	for _, fa := range a.fields {
+		for _, fb := range b.fields {
+			if fa == fb || strings.HasPrefix(fa, fb+".") || strings.HasPrefix(fb, fa+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describe tells how the write is protected against the concurrent writes.
+func (c *Checker) describe(es entrySink) string {
+	precondition, retry := "without", "without"
+	if call, ok := es.instr.(*ssa.Call); ok && tracker.HasPrecondition(call) {
+		precondition = "with"
+	}
+	if c.tracker.RetriesOnConflict(es.instr) {
+		retry = "with"
+	}
+	return fmt.Sprintf("%s: %s writes %s, %s resourceVersion precondition, %s retry.RetryOnConflict",
+		es.controller, es.trigger, es.sink, precondition, retry)
+}
+
+// Conflicts reports the pairs of sinks of different controllers writing the same field group
+// of the same resource, with the triggering events on both sides and how each write is protected.
+// The checkers must share the same program, see collector.CollectComponents.
+func Conflicts(checkers ...*Checker) []Finding {
+	sinks := [][]entrySink{}
+	for _, c := range checkers {
+		sinks = append(sinks, c.entrySinks())
+	}
+	findings := []Finding{}
+	for i := range checkers {
+		for j := i + 1; j < len(checkers); j++ {
+			for _, a := range sinks[i] {
+				for _, b := range sinks[j] {
+					if !sameFieldGroup(a, b) {
+						continue
+					}
+					findings = append(findings, Finding{
+						Checker: "conflict",
+						Pos:     a.instr.Pos(),
+						Message: fmt.Sprintf("write-write conflict on %s between %s and %s", a.sink, a.controller, b.controller),
+						Related: []Location{
+							{Pos: a.instr.Pos(), Note: checkers[i].describe(a)},
+							{Pos: b.instr.Pos(), Note: checkers[j].describe(b)},
+						},
+					})
+				}
+			}
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Pos != findings[j].Pos {
+			return findings[i].Pos < findings[j].Pos
+		}
+		return findings[i].Related[1].Pos < findings[j].Related[1].Pos
+	})
+	return findings
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package checker
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/tracker"
+	"strings"
+)
+
+// isReference tells whether a value of typ shares its memory when it is copied.
+func isReference(typ types.Type) bool {
+	switch typ.Underlying().(type) {
+	case *types.Pointer, *types.Map, *types.Slice, *types.Interface:
+		return true
+	}
+	return false
+}
+
+func isDeepCopy(common *ssa.CallCommon) bool {
+	name := ""
+	if common.IsInvoke() {
+		name = common.Method.Name()
+	} else if callee := common.StaticCallee(); callee != nil {
+		name = callee.Name()
+	}
+	return name == "DeepCopy" || name == "DeepCopyObject"
+}
+
+// sharedObject is an object shared with the informer cache, and where it is got from.
+type sharedObject struct {
+	value ssa.Value
+	path  string
+	// origin describes where the object is got from.
+	origin Location
+	// registration is the registration of the handler receiving the object, if any.
+	registration token.Pos
+}
+
+// trackShared follows the values aliasing the shared object and reports the writes to them.
+// The aliases stop at DeepCopy and DeepCopyObject, whose results are private.
+// A write reached from several objects is reported once, with all the origins.
+func (c *Checker) trackShared(obj sharedObject, findings *[]Finding, reported map[ssa.Instruction]int) {
+	aliases := map[ssa.Value]string{}
+	worklist := []ssa.Value{}
+	alias := func(v ssa.Value, path string) {
+		if _, found := aliases[v]; !found {
+			aliases[v] = path
+			worklist = append(worklist, v)
+		}
+	}
+	mutate := func(instr ssa.Instruction, path string) {
+		if i, found := reported[instr]; found {
+			(*findings)[i].Related = append((*findings)[i].Related, obj.origin)
+			return
+		}
+		reported[instr] = len(*findings)
+		*findings = append(*findings, Finding{
+			Checker:      "deepcopy",
+			Pos:          instr.Pos(),
+			Message:      fmt.Sprintf("%s is mutated without DeepCopy in %s", path, instr.Parent().Name()),
+			Related:      []Location{obj.origin},
+			Registration: obj.registration,
+		})
+	}
+
+	alias(obj.value, obj.path)
+	for len(worklist) != 0 {
+		v := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		path := aliases[v]
+		if v.Referrers() == nil {
+			continue
+		}
+		for _, ref := range *v.Referrers() {
+			switch ref.(type) {
+			case *ssa.FieldAddr:
+				fa := ref.(*ssa.FieldAddr)
+				alias(fa, path+"."+tracker.FieldName(fa.X, fa.Field))
+			case *ssa.Field:
+				f := ref.(*ssa.Field)
+				if isReference(f.Type()) {
+					alias(f, path+"."+tracker.FieldName(f.X, f.Field))
+				}
+			case *ssa.IndexAddr:
+				alias(ref.(*ssa.IndexAddr), path+"[]")
+			case *ssa.Index, *ssa.Lookup:
+				if isReference(ref.(ssa.Value).Type()) {
+					alias(ref.(ssa.Value), path+"[]")
+				}
+			case *ssa.UnOp:
+				uo := ref.(*ssa.UnOp)
+				if uo.Op == token.MUL && isReference(uo.Type()) {
+					alias(uo, path)
+				}
+			case *ssa.Extract:
+				if isReference(ref.(ssa.Value).Type()) {
+					alias(ref.(ssa.Value), path)
+				}
+			case *ssa.TypeAssert, *ssa.ChangeType, *ssa.MakeInterface, *ssa.Phi:
+				alias(ref.(ssa.Value), path)
+			case *ssa.Store:
+				st := ref.(*ssa.Store)
+				// a field (or an element of a field) of the object, or the object itself
+				if st.Addr == v && (strings.Contains(path, ".") || tracker.IsAPIObject(v.Type())) {
+					mutate(st, path)
+				}
+			case *ssa.MapUpdate:
+				if mu := ref.(*ssa.MapUpdate); mu.Map == v {
+					mutate(mu, path)
+				}
+			case *ssa.Call:
+				common := ref.(*ssa.Call).Common()
+				if isDeepCopy(common) {
+					continue
+				}
+				// the helpers of the package may mutate their arguments
+				callee := common.StaticCallee()
+				if callee == nil || len(callee.Blocks) == 0 || !c.inPackage(callee) {
+					continue
+				}
+				for i, arg := range common.Args {
+					if arg == v && i < len(callee.Params) {
+						alias(callee.Params[i], path)
+					}
+				}
+			}
+		}
+	}
+}
+
+// sharedObjects returns the objects shared with the informer caches: the parameters
+// of the handlers and the results of the lister and indexer reads.
+func (c *Checker) sharedObjects() []sharedObject {
+	objs := []sharedObject{}
+	for call, handlers := range c.handlerMap {
+		for event, handler := range handlers {
+			for _, param := range handler.Params {
+				objs = append(objs, sharedObject{value: param, path: param.Name(), origin: Location{
+					Pos:  call.Pos(),
+					Note: fmt.Sprintf("%s is delivered to the %s handler %s registered here", param.Name(), event, handler.Name()),
+				}, registration: call.Pos()})
+			}
+		}
+	}
+	for _, fun := range c.packageFunctions() {
+		for _, block := range fun.Blocks {
+			for _, instr := range block.Instrs {
+				if call, ok := instr.(*ssa.Call); ok && tracker.IsCacheRead(call.Common()) {
+					objs = append(objs, sharedObject{value: call, path: tracker.RootPath, origin: Location{
+						Pos:  call.Pos(),
+						Note: "obj is read from the informer cache here",
+					}})
+				}
+			}
+		}
+	}
+	return objs
+}
+
+// CheckDeepCopy reports the writes to the objects shared with the informer caches.
+// Such objects must be copied with DeepCopy before being modified.
+func (c *Checker) CheckDeepCopy() []Finding {
+	findings := []Finding{}
+	reported := map[ssa.Instruction]int{}
+	for _, obj := range c.sharedObjects() {
+		c.trackShared(obj, &findings, reported)
+	}
+	return findings
+}
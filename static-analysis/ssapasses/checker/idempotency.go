@@ -0,0 +1,256 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package checker
+
+import (
+	"fmt"
+	"go/token"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/tracker"
+	"sort"
+)
+
+// versionFields are the fields of ObjectMeta telling whether an object changed.
+var versionFields = map[string]struct{}{
+	"ResourceVersion": {},
+	"Generation":      {},
+}
+
+// objectOf returns the value the field loads of v are based on, e.g. the parameter newObj
+// for newObj.(*v1.Pod).ResourceVersion.
+func objectOf(v ssa.Value) ssa.Value {
+	for {
+		switch v.(type) {
+		case *ssa.FieldAddr:
+			v = v.(*ssa.FieldAddr).X
+		case *ssa.Field:
+			v = v.(*ssa.Field).X
+		case *ssa.UnOp:
+			v = v.(*ssa.UnOp).X
+		case *ssa.TypeAssert:
+			v = v.(*ssa.TypeAssert).X
+		case *ssa.Extract:
+			v = v.(*ssa.Extract).Tuple
+		case *ssa.MakeInterface:
+			v = v.(*ssa.MakeInterface).X
+		case *ssa.ChangeInterface:
+			v = v.(*ssa.ChangeInterface).X
+		case *ssa.ChangeType:
+			v = v.(*ssa.ChangeType).X
+		default:
+			return v
+		}
+	}
+}
+
+// versionOf returns the field of v if it is a load of ResourceVersion or Generation, and the object loaded.
+func versionOf(v ssa.Value) (string, ssa.Value) {
+	var field string
+	switch v.(type) {
+	case *ssa.UnOp:
+		if fa, ok := v.(*ssa.UnOp).X.(*ssa.FieldAddr); ok {
+			field = tracker.FieldName(fa.X, fa.Field)
+		}
+	case *ssa.Field:
+		f := v.(*ssa.Field)
+		field = tracker.FieldName(f.X, f.Field)
+	}
+	if _, found := versionFields[field]; !found {
+		return "", nil
+	}
+	return field, objectOf(v)
+}
+
+// versions is the old and the new object of an Update handler, as seen in a function.
+type versions struct {
+	old, new ssa.Value
+}
+
+// compares tells whether bo compares the same version field of the old and the new object.
+func (vs versions) compares(bo *ssa.BinOp) bool {
+	fieldX, objX := versionOf(bo.X)
+	fieldY, objY := versionOf(bo.Y)
+	if fieldX == "" || fieldX != fieldY || vs.old == nil || vs.new == nil {
+		return false
+	}
+	return (objX == vs.old && objY == vs.new) || (objX == vs.new && objY == vs.old)
+}
+
+// deepEquals tells whether common calls DeepEqual on the old and the new object. Its
+// last two arguments are compared, after the receiver of equality.Semantic.DeepEqual.
+func (vs versions) deepEquals(common *ssa.CallCommon) bool {
+	if calleeName(common) != "DeepEqual" || len(common.Args) < 2 || vs.old == nil || vs.new == nil {
+		return false
+	}
+	x, y := objectOf(common.Args[len(common.Args)-2]), objectOf(common.Args[len(common.Args)-1])
+	return (x == vs.old && y == vs.new) || (x == vs.new && y == vs.old)
+}
+
+// callee returns the old and the new object as seen in the callee, when they are passed as arguments.
+func (vs versions) callee(common *ssa.CallCommon, callee *ssa.Function) versions {
+	result := versions{}
+	for i, arg := range common.Args {
+		if i >= len(callee.Params) {
+			break
+		}
+		switch objectOf(arg) {
+		case nil:
+		case vs.old:
+			result.old = callee.Params[i]
+		case vs.new:
+			result.new = callee.Params[i]
+		}
+	}
+	return result
+}
+
+// unchangedSucc returns the successor of the branch taken when the object did not change,
+// if the branch compares the versions of the old and the new object or calls DeepEqual on them.
+func (vs versions) unchangedSucc(branch *ssa.If) *ssa.BasicBlock {
+	cond := branch.Cond
+	negated := false
+	for {
+		uo, ok := cond.(*ssa.UnOp)
+		if !ok || uo.Op != token.NOT {
+			break
+		}
+		cond = uo.X
+		negated = !negated
+	}
+	equal := false
+	switch cond.(type) {
+	case *ssa.BinOp:
+		bo := cond.(*ssa.BinOp)
+		if !vs.compares(bo) {
+			return nil
+		}
+		switch bo.Op {
+		case token.EQL:
+			equal = true
+		case token.NEQ:
+			equal = false
+		default:
+			return nil
+		}
+	case *ssa.Call:
+		// reflect.DeepEqual(old, new) and equality.Semantic.DeepEqual(old, new)
+		if !vs.deepEquals(cond.(*ssa.Call).Common()) {
+			return nil
+		}
+		equal = true
+	default:
+		return nil
+	}
+	if equal != negated {
+		return branch.Block().Succs[0]
+	}
+	return branch.Block().Succs[1]
+}
+
+// unchangedWrites returns the writes executed when old == new: the successors of the
+// branches comparing the versions are only followed on the unchanged side.
+// The writes are the API calls, the items put into the workqueues and the field stores.
+func (c *Checker) unchangedWrites(fn *ssa.Function, vs versions, visited map[*ssa.Function]struct{}) map[ssa.Instruction]string {
+	writes := map[ssa.Instruction]string{}
+	if _, found := visited[fn]; found || len(fn.Blocks) == 0 {
+		return writes
+	}
+	visited[fn] = struct{}{}
+	reached := map[*ssa.BasicBlock]struct{}{}
+	worklist := []*ssa.BasicBlock{fn.Blocks[0]}
+	for len(worklist) != 0 {
+		block := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if _, found := reached[block]; found {
+			continue
+		}
+		reached[block] = struct{}{}
+		for _, instr := range block.Instrs {
+			switch instr.(type) {
+			case *ssa.Store:
+				if fa, ok := instr.(*ssa.Store).Addr.(*ssa.FieldAddr); ok && !isLocal(fa) {
+					writes[instr] = fmt.Sprintf("writes %s", tracker.FieldName(fa.X, fa.Field))
+				}
+			case *ssa.Call:
+				common := instr.(*ssa.Call).Common()
+				if sink, found := c.tracker.CallSink(common); found {
+					writes[instr] = fmt.Sprintf("calls %s writing %s", calleeName(common), sink)
+				} else if tracker.IsQueueWrite(common) {
+					writes[instr] = fmt.Sprintf("calls %s on a workqueue", common.Method.Name())
+				} else if callee := common.StaticCallee(); callee != nil && c.inPackage(callee) {
+					for w, desc := range c.unchangedWrites(callee, vs.callee(common, callee), visited) {
+						writes[w] = desc
+					}
+				}
+			}
+		}
+		succs := block.Succs
+		if len(block.Instrs) != 0 {
+			if branch, ok := block.Instrs[len(block.Instrs)-1].(*ssa.If); ok {
+				if succ := vs.unchangedSucc(branch); succ != nil {
+					succs = []*ssa.BasicBlock{succ}
+				}
+			}
+		}
+		worklist = append(worklist, succs...)
+	}
+	return writes
+}
+
+// isLocal tells whether the field belongs to a value allocated in the function, e.g. a new object.
+func isLocal(fa *ssa.FieldAddr) bool {
+	base := fa.X
+	for {
+		inner, ok := base.(*ssa.FieldAddr)
+		if !ok {
+			break
+		}
+		base = inner.X
+	}
+	_, ok := base.(*ssa.Alloc)
+	return ok
+}
+
+// CheckIdempotency reports the Update handlers reaching writes when old == new, as delivered
+// by a resync: they have no early return guarded by a comparison of ResourceVersion or
+// Generation, or by DeepEqual. They are candidates for redundant API traffic and resync storms.
+func (c *Checker) CheckIdempotency() []Finding {
+	findings := []Finding{}
+	for call, handlers := range c.handlerMap {
+		handler, ok := handlers["Update"]
+		if !ok {
+			continue
+		}
+		// the last two parameters are the old and the new object
+		params := handler.Params
+		if len(params) < 2 {
+			continue
+		}
+		vs := versions{old: params[len(params)-2], new: params[len(params)-1]}
+		writes := c.unchangedWrites(handler, vs, map[*ssa.Function]struct{}{})
+		if len(writes) == 0 {
+			continue
+		}
+		instrs := []ssa.Instruction{}
+		for instr := range writes {
+			instrs = append(instrs, instr)
+		}
+		sort.Slice(instrs, func(i, j int) bool { return instrs[i].Pos() < instrs[j].Pos() })
+		first := instrs[0]
+		related := []Location{{Pos: call.Pos(), Note: fmt.Sprintf("the Update handler %s is registered here", displayName(handler))}}
+		for _, instr := range instrs[1:] {
+			related = append(related, Location{Pos: instr.Pos(), Note: fmt.Sprintf("%s also %s when old == new", displayName(instr.Parent()), writes[instr])})
+		}
+		findings = append(findings, Finding{
+			Checker: "idempotency",
+			Pos:     first.Pos(),
+			Message: fmt.Sprintf("Update handler %s %s even when old == new: no early return on ResourceVersion, Generation or DeepEqual",
+				displayName(handler), writes[first]),
+			Related:      related,
+			Registration: call.Pos(),
+		})
+	}
+	return findings
+}
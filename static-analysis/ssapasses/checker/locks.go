@@ -0,0 +1,289 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package checker
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/tracker"
+	"sort"
+	"strings"
+)
+
+// lockset is the set of the mutexes held, keyed by mutexKey.
+type lockset map[string]struct{}
+
+func (ls lockset) String() string {
+	keys := []string{}
+	for k := range ls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func (ls lockset) intersects(other lockset) bool {
+	for k := range ls {
+		if _, found := other[k]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// mutexKey identifies a mutex across the functions: the field of a type, or a global.
+func mutexKey(mutex ssa.Value) string {
+	switch mutex.(type) {
+	case *ssa.FieldAddr:
+		key := tracker.KeyOf(mutex.(*ssa.FieldAddr))
+		return fmt.Sprintf("%s.%s", key.Type, tracker.FieldName(mutex.(*ssa.FieldAddr).X, key.Field))
+	case *ssa.Global:
+		return mutex.String()
+	}
+	return mutex.Name()
+}
+
+// mustHeld computes the mutexes held at each instruction of fn on every path,
+// given the mutexes held when fn is entered. A deferred Unlock releases at the return only.
+func mustHeld(fn *ssa.Function, entry lockset) map[ssa.Instruction]lockset {
+	held := map[ssa.Instruction]lockset{}
+	out := map[*ssa.BasicBlock]lockset{}
+	for changed := true; changed; {
+		changed = false
+		for _, block := range fn.Blocks {
+			var in lockset
+			if block.Index == 0 {
+				in = entry
+			}
+			for _, pred := range block.Preds {
+				predOut, done := out[pred]
+				if !done {
+					// not computed yet: the top of the lattice
+					continue
+				}
+				if in == nil {
+					in = predOut
+					continue
+				}
+				meet := lockset{}
+				for k := range in {
+					if _, found := predOut[k]; found {
+						meet[k] = struct{}{}
+					}
+				}
+				in = meet
+			}
+			cur := lockset{}
+			for k := range in {
+				cur[k] = struct{}{}
+			}
+			for _, instr := range block.Instrs {
+				held[instr] = cur
+				call, ok := instr.(*ssa.Call)
+				if !ok {
+					continue
+				}
+				op, mutex := mutexOp(call.Common())
+				if op == "" {
+					continue
+				}
+				next := lockset{}
+				for k := range cur {
+					next[k] = struct{}{}
+				}
+				if op == "Lock" || op == "RLock" {
+					next[mutexKey(mutex)] = struct{}{}
+				} else {
+					delete(next, mutexKey(mutex))
+				}
+				cur = next
+			}
+			if prev, done := out[block]; !done || prev.String() != cur.String() {
+				out[block] = cur
+				changed = true
+			}
+		}
+	}
+	return held
+}
+
+// fieldAccess is a read or a write of a field with the mutexes held.
+type fieldAccess struct {
+	instr ssa.Instruction
+	// entry is the handler or the worker the access is reached from.
+	entry *ssa.Function
+	// role is "handler" or "worker"
+	role string
+	held lockset
+}
+
+// isSynchronized tells whether a field of typ synchronizes itself, e.g. a mutex, a channel or a workqueue.
+func isSynchronized(typ types.Type) bool {
+	if _, ok := typ.Underlying().(*types.Chan); ok {
+		return true
+	}
+	if tracker.IsQueue(typ) {
+		return true
+	}
+	named, ok := tracker.DerefType(typ).(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "sync"
+}
+
+// heldFrom computes the mutexes held at the instructions reached from entry, also in the
+// callees of the package, which are followed with the mutexes held at the call. An instruction
+// reached with several locksets holds the mutexes common to them.
+func (c *Checker) heldFrom(entry *ssa.Function) map[ssa.Instruction]lockset {
+	result := map[ssa.Instruction]lockset{}
+	visited := map[string]struct{}{}
+	var walk func(fn *ssa.Function, locks lockset)
+	walk = func(fn *ssa.Function, locks lockset) {
+		key := fn.String() + "|" + locks.String()
+		if _, found := visited[key]; found {
+			return
+		}
+		visited[key] = struct{}{}
+		held := mustHeld(fn, locks)
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				if prev, found := result[instr]; !found {
+					result[instr] = held[instr]
+				} else {
+					meet := lockset{}
+					for k := range prev {
+						if _, found := held[instr][k]; found {
+							meet[k] = struct{}{}
+						}
+					}
+					result[instr] = meet
+				}
+				if call, ok := instr.(*ssa.Call); ok {
+					callee := call.Common().StaticCallee()
+					if callee != nil && len(callee.Blocks) != 0 && c.inPackage(callee) {
+						walk(callee, held[instr])
+					}
+				}
+			}
+		}
+	}
+	walk(entry, lockset{})
+	return result
+}
+
+// memberName returns the name of the field of a type of the package fa addresses, e.g.
+// "Controller.lastNode", or "" for the other fields and the synchronized ones.
+func (c *Checker) memberName(fa *ssa.FieldAddr) string {
+	named, ok := tracker.DerefType(fa.X.Type()).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != c.pattern ||
+		isSynchronized(tracker.DerefType(fa.Type())) {
+		return ""
+	}
+	return fmt.Sprintf("%s.%s", named.Obj().Name(), tracker.FieldName(fa.X, fa.Field))
+}
+
+// handlerWrites collects the stores to the members the tracker finds written by the handler.
+func (c *Checker) handlerWrites(handler *ssa.Function, writes map[string][]fieldAccess, keys map[tracker.FieldKey]string) {
+	held := c.heldFrom(handler)
+	for _, member := range c.tracker.FlowFrom(handler).Written {
+		field := c.memberName(member)
+		if field == "" {
+			continue
+		}
+		keys[tracker.KeyOf(member)] = field
+		for _, ref := range *member.Referrers() {
+			if st, ok := ref.(*ssa.Store); ok && st.Addr == member {
+				writes[field] = append(writes[field], fieldAccess{instr: st, entry: handler, role: "handler", held: held[st]})
+			}
+		}
+	}
+}
+
+// entryReads collects the reads of the written members reached from the entry point:
+// the read points of the tracker, and the loads of the members.
+func (c *Checker) entryReads(entry *ssa.Function, role string, keys map[tracker.FieldKey]string, reads map[string][]fieldAccess) {
+	held := c.heldFrom(entry)
+	points := map[ssa.Instruction]string{}
+	for _, read := range c.tracker.FlowFrom(entry).Reads {
+		if instr, ok := read.Value.(ssa.Instruction); ok {
+			points[instr] = keys[tracker.KeyOf(read.Member)]
+		}
+	}
+	for instr, locks := range held {
+		field := points[instr]
+		if uo, ok := instr.(*ssa.UnOp); ok && uo.Op == token.MUL {
+			if fa, ok := uo.X.(*ssa.FieldAddr); ok {
+				field = keys[tracker.KeyOf(fa)]
+			}
+		}
+		if field != "" {
+			reads[field] = append(reads[field], fieldAccess{instr: instr, entry: entry, role: role, held: locks})
+		}
+	}
+}
+
+// CheckLocksets reports the members the tracker finds written by a handler, and read from
+// another entry point without a common mutex held: candidate data races.
+func (c *Checker) CheckLocksets() []Finding {
+	writes, keys := map[string][]fieldAccess{}, map[tracker.FieldKey]string{}
+	for _, handlers := range c.handlerMap {
+		for _, handler := range handlers {
+			c.handlerWrites(handler, writes, keys)
+		}
+	}
+	reads := map[string][]fieldAccess{}
+	for _, handlers := range c.handlerMap {
+		for _, handler := range handlers {
+			c.entryReads(handler, "handler", keys, reads)
+		}
+	}
+	for _, triggers := range c.triggerMap {
+		for _, worker := range triggers {
+			c.entryReads(worker, "worker", keys, reads)
+		}
+	}
+
+	findings := []Finding{}
+	fields := []string{}
+	for field := range writes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		sortAccesses(writes[field])
+		sortAccesses(reads[field])
+		// each entry point reading the field is reported once
+		reported := map[*ssa.Function]struct{}{}
+		for _, write := range writes[field] {
+			for _, read := range reads[field] {
+				if _, found := reported[read.entry]; found || read.entry == write.entry || write.held.intersects(read.held) {
+					continue
+				}
+				reported[read.entry] = struct{}{}
+				findings = append(findings, Finding{
+					Checker: "lockset",
+					Pos:     write.instr.Pos(),
+					Message: fmt.Sprintf("%s is written by handler %s and read by %s %s with no common lock",
+						field, displayName(write.entry), read.role, displayName(read.entry)),
+					Related: []Location{{
+						Pos:  read.instr.Pos(),
+						Note: fmt.Sprintf("read in %s holding {%s}", displayName(read.instr.Parent()), read.held),
+					}},
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// sortAccesses sorts the accesses by position, so that the same pair is reported on every run.
+func sortAccesses(accesses []fieldAccess) {
+	sort.Slice(accesses, func(i, j int) bool {
+		if accesses[i].instr.Pos() != accesses[j].instr.Pos() {
+			return accesses[i].instr.Pos() < accesses[j].instr.Pos()
+		}
+		return accesses[i].entry.String() < accesses[j].entry.String()
+	})
+}
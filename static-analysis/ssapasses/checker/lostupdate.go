@@ -0,0 +1,376 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package checker
+
+import (
+	"fmt"
+	"go/token"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+	"sort"
+)
+
+// derivation maps each value derived from a cache read to the value it is derived from.
+type derivation map[ssa.Value]ssa.Value
+
+// derive follows the object read from the cache: through the conversions, the copies made by
+// DeepCopy, the elements of the lists, and the parameters of the functions of the package.
+// The results of json.Marshal on the object are derived from it too.
+func (c *Checker) derive(read *ssa.Call) derivation {
+	from := derivation{read: nil}
+	worklist := []ssa.Value{read}
+	add := func(v, parent ssa.Value) {
+		if _, found := from[v]; !found {
+			from[v] = parent
+			worklist = append(worklist, v)
+		}
+	}
+	for len(worklist) != 0 {
+		v := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if v.Referrers() == nil {
+			continue
+		}
+		for _, ref := range *v.Referrers() {
+			switch ref.(type) {
+			case *ssa.Extract, *ssa.TypeAssert, *ssa.ChangeType, *ssa.MakeInterface, *ssa.Phi,
+				*ssa.IndexAddr, *ssa.Index, *ssa.Slice, *ssa.Convert:
+				add(ref.(ssa.Value), v)
+			case *ssa.UnOp:
+				if ref.(*ssa.UnOp).Op == token.MUL && isReference(ref.(*ssa.UnOp).Type()) {
+					add(ref.(ssa.Value), v)
+				}
+			case *ssa.Call:
+				call := ref.(*ssa.Call)
+				common := call.Common()
+				if isDeepCopy(common) || calleeName(common) == "Marshal" {
+					add(call, v)
+					continue
+				}
+				callee := common.StaticCallee()
+				if callee == nil || len(callee.Blocks) == 0 || !c.inPackage(callee) {
+					continue
+				}
+				for i, arg := range common.Args {
+					if arg == v && i < len(callee.Params) {
+						add(callee.Params[i], v)
+					}
+				}
+			}
+		}
+	}
+	return from
+}
+
+// modification returns the first write to the fields of v, if any.
+func modification(v ssa.Value) ssa.Instruction {
+	if !tracker.IsAPIObject(v.Type()) {
+		return nil
+	}
+	var first ssa.Instruction
+	worklist := []ssa.Value{v}
+	for len(worklist) != 0 {
+		cur := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		for _, ref := range *cur.Referrers() {
+			var write ssa.Instruction
+			switch ref.(type) {
+			case *ssa.FieldAddr:
+				worklist = append(worklist, ref.(*ssa.FieldAddr))
+			case *ssa.UnOp:
+				// the maps and slices of the object, e.g. pod.Labels[k] = v
+				if uo := ref.(*ssa.UnOp); uo.Op == token.MUL && isReference(uo.Type()) && cur != v {
+					worklist = append(worklist, uo)
+				}
+			case *ssa.Store:
+				if ref.(*ssa.Store).Addr == cur && cur != v {
+					write = ref
+				}
+			case *ssa.MapUpdate:
+				if ref.(*ssa.MapUpdate).Map == cur {
+					write = ref
+				}
+			}
+			if write != nil && (first == nil || write.Pos() < first.Pos()) {
+				first = write
+			}
+		}
+	}
+	return first
+}
+
+// modifiedAlong returns the first modification of the values v is derived from, including
+// the ones made by the functions of the package these values are passed to.
+func modifiedAlong(from derivation, v ssa.Value) ssa.Instruction {
+	along := map[ssa.Value]struct{}{}
+	for cur := v; cur != nil; cur = from[cur] {
+		along[cur] = struct{}{}
+	}
+	var first ssa.Instruction
+	for derived, parent := range from {
+		_, onChain := along[derived]
+		if _, isParam := derived.(*ssa.Parameter); !onChain {
+			if _, passed := along[parent]; !isParam || !passed {
+				continue
+			}
+		}
+		if write := modification(derived); write != nil && (first == nil || write.Pos() < first.Pos()) {
+			first = write
+		}
+	}
+	return first
+}
+
+// errorOf returns the error returned by the call, if any.
+func errorOf(call *ssa.Call) ssa.Value {
+	results := call.Common().Signature().Results()
+	if results.Len() == 1 {
+		return call
+	}
+	for _, ref := range *call.Referrers() {
+		if ex, ok := ref.(*ssa.Extract); ok && ex.Index == results.Len()-1 {
+			return ex
+		}
+	}
+	return nil
+}
+
+// errorDepth bounds the callers the error of a write is returned through.
+const errorDepth = 4
+
+// handlesConflict tells whether the write is protected against the concurrent updates:
+// it is retried with retry.RetryOnConflict, its error is checked with IsConflict or requeues
+// the key, or its error is returned up to a requeuing worker which requeues the key on it.
+func (c *Checker) handlesConflict(call *ssa.Call) bool {
+	if c.tracker.RetriesOnConflict(call) {
+		return true
+	}
+	err := errorOf(call)
+	if err == nil {
+		return false
+	}
+	requeuers := map[*ssa.Function]struct{}{}
+	for _, triggers := range c.triggerMap {
+		if fn, ok := triggers[collector.Requeue]; ok {
+			requeuers[fn] = struct{}{}
+		}
+	}
+	if len(requeuers) == 0 {
+		return c.errorHandled(err, nil, nil, errorDepth)
+	}
+	return c.errorHandled(err, requeuers, c.callSites(), errorDepth)
+}
+
+// callSites returns the call sites of the functions of the package, computed once.
+func (c *Checker) callSites() map[*ssa.Function][]*ssa.Call {
+	if c.sites != nil {
+		return c.sites
+	}
+	// the call sites of the functions of the package, also through the fields, e.g. c.syncHandler(key),
+	// and through the wrappers of the method values, e.g. c.syncPod$bound
+	c.sites = map[*ssa.Function][]*ssa.Call{}
+	funs := c.packageFunctions()
+	scanned := map[*ssa.Function]struct{}{}
+	for len(funs) != 0 {
+		fn := funs[len(funs)-1]
+		funs = funs[:len(funs)-1]
+		if _, found := scanned[fn]; found {
+			continue
+		}
+		scanned[fn] = struct{}{}
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				site, ok := instr.(*ssa.Call)
+				if !ok {
+					continue
+				}
+				for _, callee := range c.tracker.Callees(site.Common()) {
+					c.sites[callee] = append(c.sites[callee], site)
+					if callee.Synthetic != "" {
+						funs = append(funs, callee)
+					}
+				}
+			}
+		}
+	}
+	return c.sites
+}
+
+// errorHandled tells whether err is checked with IsConflict, requeues the key on a branch, or is
+// returned to a call site in a requeuing worker where it does, at most depth callers away.
+func (c *Checker) errorHandled(err ssa.Value, requeuers map[*ssa.Function]struct{}, sites map[*ssa.Function][]*ssa.Call, depth int) bool {
+	visited := map[ssa.Value]struct{}{}
+	worklist := []ssa.Value{err}
+	for len(worklist) != 0 {
+		v := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if _, found := visited[v]; found || v.Referrers() == nil {
+			continue
+		}
+		visited[v] = struct{}{}
+		for _, ref := range *v.Referrers() {
+			switch ref.(type) {
+			case *ssa.Phi, *ssa.ChangeType, *ssa.MakeInterface:
+				worklist = append(worklist, ref.(ssa.Value))
+			case *ssa.Call:
+				if calleeName(ref.(*ssa.Call).Common()) == "IsConflict" {
+					return true
+				}
+			case *ssa.Return:
+				if depth == 0 {
+					continue
+				}
+				for _, site := range sites[ref.Parent()] {
+					if returned := errorOf(site); returned != nil && c.requeuedFrom(site.Parent(), requeuers, sites, depth-1) &&
+						c.errorHandled(returned, requeuers, sites, depth-1) {
+						return true
+					}
+				}
+			case *ssa.BinOp:
+				// if err != nil { c.queue.AddRateLimited(key) }
+				for _, cond := range *ref.(*ssa.BinOp).Referrers() {
+					if branch, ok := cond.(*ssa.If); ok && requeuesWithin(branch) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// requeuedFrom tells whether fn is a requeuing worker, or is called by one at most depth callers away.
+func (c *Checker) requeuedFrom(fn *ssa.Function, requeuers map[*ssa.Function]struct{}, sites map[*ssa.Function][]*ssa.Call, depth int) bool {
+	if _, found := requeuers[fn]; found {
+		return true
+	}
+	if depth == 0 {
+		return false
+	}
+	for _, site := range sites[fn] {
+		if c.requeuedFrom(site.Parent(), requeuers, sites, depth-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// requeuesWithin tells whether an item is put back into a workqueue on a side of the branch.
+func requeuesWithin(branch *ssa.If) bool {
+	for _, succ := range branch.Block().Succs {
+		for _, instr := range succ.Instrs {
+			if call, ok := instr.(*ssa.Call); ok && tracker.IsQueueWrite(call.Common()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// witness returns the chain from the read to v, and the modification made on the way, if any.
+func witness(from derivation, v ssa.Value, modified ssa.Instruction) []Location {
+	chain := []Location{}
+	for cur := v; cur != nil; cur = from[cur] {
+		switch cur.(type) {
+		case *ssa.Call:
+			note := fmt.Sprintf("%s is called here", calleeName(cur.(*ssa.Call).Common()))
+			if from[cur] == nil {
+				note = "the object is read from the informer cache here"
+			}
+			chain = append(chain, Location{Pos: cur.Pos(), Note: note})
+		case *ssa.Parameter:
+			chain = append(chain, Location{Pos: cur.Pos(), Note: fmt.Sprintf("the object is passed to %s", displayName(cur.Parent()))})
+		}
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	if modified != nil {
+		chain = append(chain, Location{Pos: modified.Pos(), Note: fmt.Sprintf("the object is modified in %s", displayName(modified.Parent()))})
+	}
+	return chain
+}
+
+// CheckLostUpdates reports the read-modify-write chains prone to lost updates: an object read
+// from the cache is modified and written back with Update without handling the conflicts,
+// or a Patch body is marshaled from the full object read from the cache.
+func (c *Checker) CheckLostUpdates() []Finding {
+	findings := []Finding{}
+	for _, fun := range c.packageFunctions() {
+		for _, block := range fun.Blocks {
+			for _, instr := range block.Instrs {
+				read, ok := instr.(*ssa.Call)
+				if !ok || !tracker.IsCacheRead(read.Common()) {
+					continue
+				}
+				findings = append(findings, c.lostUpdates(read)...)
+			}
+		}
+	}
+	return findings
+}
+
+func (c *Checker) lostUpdates(read *ssa.Call) []Finding {
+	from := c.derive(read)
+	values := []ssa.Value{}
+	for v := range from {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Pos() < values[j].Pos() })
+
+	findings := []Finding{}
+	reported := map[*ssa.Call]struct{}{}
+	for _, v := range values {
+		for _, ref := range *v.Referrers() {
+			call, ok := ref.(*ssa.Call)
+			if !ok {
+				continue
+			}
+			if _, found := reported[call]; found {
+				continue
+			}
+			sink, found := c.tracker.CallSink(call.Common())
+			if !found || c.handlesConflict(call) {
+				continue
+			}
+			method := calleeName(call.Common())
+			var message string
+			var modified ssa.Instruction
+			switch method {
+			case "Update", "UpdateStatus":
+				modified = modifiedAlong(from, v)
+				if modified == nil || !tracker.IsAPIObject(v.Type()) {
+					continue
+				}
+				message = fmt.Sprintf("%s reads a %s from the cache, modifies it and calls %s without conflict handling",
+					displayName(read.Parent()), sink.Resource, method)
+			case "Patch":
+				marshaled := false
+				for cur := v; cur != nil && !marshaled; cur = from[cur] {
+					marshal, ok := cur.(*ssa.Call)
+					marshaled = ok && calleeName(marshal.Common()) == "Marshal"
+				}
+				if !marshaled {
+					continue
+				}
+				message = fmt.Sprintf("%s patches a %s with a body marshaled from the full object read from the cache",
+					displayName(read.Parent()), sink.Resource)
+			default:
+				continue
+			}
+			reported[call] = struct{}{}
+			related := witness(from, v, modified)
+			related = append(related, Location{Pos: call.Pos(), Note: fmt.Sprintf("%s writes %s without conflict handling", method, sink)})
+			findings = append(findings, Finding{
+				Checker: "lostupdate",
+				Pos:     call.Pos(),
+				Message: message,
+				Related: related,
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package testdata
+
+import (
+	"context"
+	v1 "kubetorch/ssapasses/checker/testdata/k8s.io/api/core/v1"
+	metav1 "kubetorch/ssapasses/checker/testdata/k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+func (c *Controller) addNode(obj interface{}) {
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		return
+	}
+	c.recordNode(node)
+	c.mu.Lock()
+	c.nodes[node.Name] = true
+	c.mu.Unlock()
+}
+
+func (c *Controller) recordNode(node *v1.Node) {
+	// the buffered channel does not block
+	c.updates <- node.Name
+	c.events <- node.Name
+	time.Sleep(time.Second)
+}
+
+func (c *Controller) updateNode(oldObj, newObj interface{}) {
+	node, ok := newObj.(*v1.Node)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client.Delete(context.TODO(), node.Name, metav1.DeleteOptions{})
+	c.wg.Wait()
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package testdata
+
+import (
+	"context"
+	v1 "kubetorch/ssapasses/checker/testdata/k8s.io/api/core/v1"
+	metav1 "kubetorch/ssapasses/checker/testdata/k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/tools/cache"
+)
+
+func (c *Controller) addPod(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) updatePod(old, cur interface{}) {
+	pod := cur.(*v1.Pod)
+	pod.Status.Phase = "Pending"
+	c.queue.Add(pod.Name)
+}
+
+// syncPod copies the object before updating it.
+func (c *Controller) syncPod(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	pod, err := c.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	pod = pod.DeepCopy()
+	pod.Status.Phase = "Running"
+	_, err = c.client.UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *Controller) syncLabels(namespace, name string) error {
+	pod, err := c.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	setLabel(pod)
+	_, err = c.client.Update(context.TODO(), pod, metav1.UpdateOptions{})
+	return err
+}
+
+func setLabel(pod *v1.Pod) {
+	pod.Labels["synced"] = "true"
+}
+
+func (c *Controller) unbindPods(nodeName string) {
+	objs, err := c.podIndexer.ByIndex("node", nodeName)
+	if err != nil {
+		return
+	}
+	for _, obj := range objs {
+		pod := obj.(*v1.Pod)
+		pod.Spec.NodeName = ""
+		c.client.Update(context.TODO(), pod, metav1.UpdateOptions{})
+	}
+}
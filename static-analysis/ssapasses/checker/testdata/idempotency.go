@@ -0,0 +1,51 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package testdata
+
+import (
+	"reflect"
+
+	v1 "kubetorch/ssapasses/checker/testdata/k8s.io/api/core/v1"
+)
+
+// resyncPod ignores the resyncs.
+func (c *Controller) resyncPod(oldObj, newObj interface{}) {
+	oldPod, ok := oldObj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	newPod, ok := newObj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	if oldPod.ResourceVersion == newPod.ResourceVersion {
+		return
+	}
+	c.queue.Add(newPod.Name)
+}
+
+// relabelPod compares the new version with a constant only, which holds on a resync.
+func (c *Controller) relabelPod(oldObj, newObj interface{}) {
+	newPod, ok := newObj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	if newPod.ResourceVersion == "" {
+		return
+	}
+	c.queue.Add(newPod.Name)
+}
+
+// labelPod compares the new object with itself, which holds on a resync.
+func (c *Controller) labelPod(oldObj, newObj interface{}) {
+	newPod, ok := newObj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	if reflect.DeepEqual(newPod, newPod) {
+		return
+	}
+	c.queue.Add(newPod.Name)
+}
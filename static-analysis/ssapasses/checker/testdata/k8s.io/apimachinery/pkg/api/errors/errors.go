@@ -0,0 +1,18 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package errors
+
+type StatusError struct {
+	Reason string
+}
+
+func (e *StatusError) Error() string {
+	return e.Reason
+}
+
+func IsConflict(err error) bool {
+	status, ok := err.(*StatusError)
+	return ok && status.Reason == "Conflict"
+}
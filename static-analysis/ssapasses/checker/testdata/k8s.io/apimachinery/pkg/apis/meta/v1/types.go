@@ -0,0 +1,39 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package v1
+
+type TypeMeta struct {
+	Kind       string
+	APIVersion string
+}
+
+type ObjectMeta struct {
+	Name            string
+	Namespace       string
+	UID             string
+	ResourceVersion string
+	Generation      int64
+	Labels          map[string]string
+	Finalizers      []string
+}
+
+type CreateOptions struct{}
+
+type UpdateOptions struct{}
+
+type PatchOptions struct{}
+
+type Preconditions struct {
+	UID             *string
+	ResourceVersion *string
+}
+
+type DeleteOptions struct {
+	Preconditions *Preconditions
+}
+
+func (meta *ObjectMeta) GetName() string { return meta.Name }
+
+func (meta *ObjectMeta) GetNamespace() string { return meta.Namespace }
@@ -0,0 +1,19 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package v1
+
+import (
+	listers "kubetorch/ssapasses/checker/testdata/k8s.io/client-go/listers/core/v1"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/tools/cache"
+)
+
+type PodInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() listers.PodLister
+}
+
+type NodeInformer interface {
+	Informer() cache.SharedIndexInformer
+}
@@ -0,0 +1,17 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package v1
+
+import (
+	v1 "kubetorch/ssapasses/checker/testdata/k8s.io/api/core/v1"
+)
+
+type PodLister interface {
+	Pods(namespace string) PodNamespaceLister
+}
+
+type PodNamespaceLister interface {
+	Get(name string) (*v1.Pod, error)
+}
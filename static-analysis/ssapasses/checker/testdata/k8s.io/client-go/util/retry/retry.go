@@ -0,0 +1,22 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package retry
+
+import (
+	"kubetorch/ssapasses/checker/testdata/k8s.io/apimachinery/pkg/util/wait"
+	"time"
+)
+
+var DefaultRetry = wait.Backoff{Duration: 10 * time.Millisecond, Steps: 5}
+
+func RetryOnConflict(backoff wait.Backoff, fn func() error) error {
+	var err error
+	for i := 0; i < backoff.Steps; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
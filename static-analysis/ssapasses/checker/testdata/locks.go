@@ -0,0 +1,26 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package testdata
+
+import (
+	"kubetorch/ssapasses/checker/testdata/k8s.io/apimachinery/pkg/util/wait"
+	"time"
+)
+
+func (c *Controller) Run(stopCh <-chan struct{}) {
+	go wait.Until(c.worker, time.Second, stopCh)
+	<-stopCh
+}
+
+func (c *Controller) worker() {
+	c.mu.Lock()
+	for name := range c.nodes {
+		c.queue.Add(name)
+	}
+	c.mu.Unlock()
+	if c.lastNode != "" {
+		c.queue.Add(c.lastNode)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package testdata
+
+import (
+	"context"
+	"encoding/json"
+	apierrors "kubetorch/ssapasses/checker/testdata/k8s.io/apimachinery/pkg/api/errors"
+	metav1 "kubetorch/ssapasses/checker/testdata/k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/apimachinery/pkg/types"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/util/retry"
+)
+
+func (c *Controller) syncPodWithRetry(namespace, name string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pod, err := c.podLister.Pods(namespace).Get(name)
+		if err != nil {
+			return err
+		}
+		pod = pod.DeepCopy()
+		pod.Status.Phase = "Running"
+		_, err = c.client.UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (c *Controller) syncPodRetried(namespace, name string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return c.setRunning(namespace, name)
+	})
+}
+
+// setRunning is retried by its caller.
+func (c *Controller) setRunning(namespace, name string) error {
+	pod, err := c.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	pod = pod.DeepCopy()
+	pod.Status.Phase = "Running"
+	_, err = c.client.UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *Controller) syncPodOnConflict(namespace, name string) {
+	pod, err := c.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return
+	}
+	pod = pod.DeepCopy()
+	pod.Status.Phase = "Running"
+	if _, err := c.client.UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{}); apierrors.IsConflict(err) {
+		c.queue.Add(name)
+	}
+}
+
+func (c *Controller) patchFromCache(namespace, name string) error {
+	pod, err := c.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	pod = pod.DeepCopy()
+	pod.Spec.NodeName = ""
+	data, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Patch(context.TODO(), name, types.MergePatchType, data, metav1.PatchOptions{})
+	return err
+}
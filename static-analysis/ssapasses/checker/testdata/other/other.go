@@ -0,0 +1,48 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+// Package other is another controller writing the pods.
+package other
+
+import (
+	"context"
+	v1 "kubetorch/ssapasses/checker/testdata/k8s.io/api/core/v1"
+	metav1 "kubetorch/ssapasses/checker/testdata/k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinformers "kubetorch/ssapasses/checker/testdata/k8s.io/client-go/informers/core/v1"
+	corev1 "kubetorch/ssapasses/checker/testdata/k8s.io/client-go/kubernetes/typed/core/v1"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/tools/cache"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/util/retry"
+)
+
+type Controller struct {
+	client corev1.PodInterface
+}
+
+func (c *Controller) addPod(obj interface{}) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	rv := pod.ResourceVersion
+	c.client.Delete(context.TODO(), pod.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &rv},
+	})
+}
+
+func (c *Controller) updatePod(oldObj, newObj interface{}) {
+	pod, ok := newObj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return c.client.Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+	})
+}
+
+func addAllEventHandlers(c *Controller, podInformer coreinformers.PodInformer) {
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.addPod,
+		UpdateFunc: c.updatePod,
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+// Package requeue is a controller requeueing the keys whose sync failed.
+package requeue
+
+import (
+	"context"
+	metav1 "kubetorch/ssapasses/checker/testdata/k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "kubetorch/ssapasses/checker/testdata/k8s.io/client-go/kubernetes/typed/core/v1"
+	listers "kubetorch/ssapasses/checker/testdata/k8s.io/client-go/listers/core/v1"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/tools/cache"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/util/workqueue"
+)
+
+type Controller struct {
+	client    corev1.PodInterface
+	podLister listers.PodLister
+	queue     workqueue.RateLimitingInterface
+
+	syncHandler func(key string) error
+}
+
+func NewController(client corev1.PodInterface, podLister listers.PodLister, queue workqueue.RateLimitingInterface) *Controller {
+	c := &Controller{client: client, podLister: podLister, queue: queue}
+	c.syncHandler = c.syncPod
+	return c
+}
+
+func (c *Controller) processNextWorkItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+	if err := c.syncHandler(key.(string)); err != nil {
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// syncPod returns the conflicts to the worker, which requeues the key.
+func (c *Controller) syncPod(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	return c.setPhase(namespace, name, "Running")
+}
+
+func (c *Controller) setPhase(namespace, name, phase string) error {
+	pod, err := c.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	pod = pod.DeepCopy()
+	pod.Status.Phase = phase
+	_, err = c.client.UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{})
+	return err
+}
+
+// finishPod returns the conflicts to no worker.
+func (c *Controller) finishPod(namespace, name string) error {
+	pod, err := c.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	pod = pod.DeepCopy()
+	pod.Status.Phase = "Succeeded"
+	_, err = c.client.UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{})
+	return err
+}
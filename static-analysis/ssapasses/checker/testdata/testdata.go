@@ -0,0 +1,61 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package testdata
+
+import (
+	coreinformers "kubetorch/ssapasses/checker/testdata/k8s.io/client-go/informers/core/v1"
+	corev1 "kubetorch/ssapasses/checker/testdata/k8s.io/client-go/kubernetes/typed/core/v1"
+	listers "kubetorch/ssapasses/checker/testdata/k8s.io/client-go/listers/core/v1"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/tools/cache"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/util/workqueue"
+	"sync"
+)
+
+type Controller struct {
+	client     corev1.PodInterface
+	podLister  listers.PodLister
+	podIndexer cache.Indexer
+	queue      workqueue.RateLimitingInterface
+
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	events  chan string
+	updates chan string
+
+	// nodes is protected by mu, while lastNode is not
+	nodes    map[string]bool
+	lastNode string
+}
+
+func NewController(client corev1.PodInterface) *Controller {
+	return &Controller{
+		client:  client,
+		events:  make(chan string),
+		updates: make(chan string, 100),
+	}
+}
+
+func addAllEventHandlers(c *Controller, podInformer coreinformers.PodInformer, nodeInformer coreinformers.NodeInformer) {
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.addPod,
+		UpdateFunc: c.updatePod,
+		DeleteFunc: c.deletePod,
+	})
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: c.resyncPod,
+		DeleteFunc: c.forgetPod,
+	})
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: c.relabelPod,
+	})
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: c.labelPod,
+	})
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.addNode,
+		UpdateFunc: c.updateNode,
+		DeleteFunc: c.deleteNode,
+	})
+}
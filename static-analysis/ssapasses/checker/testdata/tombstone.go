@@ -0,0 +1,49 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package testdata
+
+import (
+	v1 "kubetorch/ssapasses/checker/testdata/k8s.io/api/core/v1"
+	"kubetorch/ssapasses/checker/testdata/k8s.io/client-go/tools/cache"
+)
+
+// deletePod handles the tombstones.
+func (c *Controller) deletePod(obj interface{}) {
+	var pod *v1.Pod
+	switch t := obj.(type) {
+	case *v1.Pod:
+		pod = t
+	case cache.DeletedFinalStateUnknown:
+		var ok bool
+		pod, ok = t.Obj.(*v1.Pod)
+		if !ok {
+			return
+		}
+	default:
+		return
+	}
+	c.queue.Add(pod.Namespace + "/" + pod.Name)
+}
+
+func (c *Controller) forgetPod(obj interface{}) {
+	c.forget(obj)
+}
+
+func (c *Controller) forget(obj interface{}) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	if pod.Spec.NodeName == c.lastNode {
+		return
+	}
+	c.queue.Forget(pod.Name)
+}
+
+func (c *Controller) deleteNode(obj interface{}) {
+	node := obj.(*v1.Node)
+	c.lastNode = node.Name
+	c.queue.Add(node.Name)
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package checker
+
+import (
+	"fmt"
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+	"strings"
+)
+
+// tombstoneType is the type of the objects delivered to the Delete handlers
+// when the final state of the deleted object is unknown.
+const tombstoneType = "k8s.io/client-go/tools/cache.DeletedFinalStateUnknown"
+
+func isTombstone(typ types.Type) bool {
+	return collector.MatchPath(tracker.DerefType(typ).String(), tombstoneType)
+}
+
+// CheckTombstones reports the Delete handlers asserting their object to a concrete
+// type without handling cache.DeletedFinalStateUnknown. With the non-comma-ok form
+// the handler panics on a tombstone, otherwise the deletion is silently missed.
+func (c *Checker) CheckTombstones() []Finding {
+	findings := []Finding{}
+	for call, handlers := range c.handlerMap {
+		handler, ok := handlers["Delete"]
+		if !ok || len(handler.Params) == 0 {
+			continue
+		}
+		asserts := []*ssa.TypeAssert{}
+		tombstone := false
+		for _, alias := range c.aliases(handler.Params[0]) {
+			for _, ref := range *alias.Referrers() {
+				ta, ok := ref.(*ssa.TypeAssert)
+				if !ok || ta.X != alias {
+					continue
+				}
+				if isTombstone(ta.AssertedType) {
+					tombstone = true
+				} else if _, ok := ta.AssertedType.Underlying().(*types.Interface); !ok {
+					asserts = append(asserts, ta)
+				}
+			}
+		}
+		if tombstone {
+			continue
+		}
+		for _, ta := range asserts {
+			kind := collector.InformerKind(call)
+			if kind == "" {
+				kind = objectKind(ta.AssertedType)
+			}
+			consequence := "misses the deletions"
+			if !ta.CommaOk {
+				consequence = "panics"
+			}
+			findings = append(findings, Finding{
+				Checker: "tombstone",
+				Pos:     ta.Pos(),
+				Message: fmt.Sprintf("Delete handler %s asserts obj to %s without handling cache.DeletedFinalStateUnknown: it %s on a tombstone",
+					strings.TrimSuffix(handler.Name(), "$bound"), typeName(ta.AssertedType), consequence),
+				Related: []Location{{
+					Pos:  call.Pos(),
+					Note: fmt.Sprintf("the handler is registered for the %s informer here", kind),
+				}},
+				Registration: call.Pos(),
+			})
+		}
+	}
+	return findings
+}
+
+// objectKind returns the name of the type typ points to, e.g. "Pod" for *v1.Pod.
+func objectKind(typ types.Type) string {
+	if named, ok := tracker.DerefType(typ).(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	return typ.String()
+}
@@ -5,11 +5,18 @@
 package collector
 
 import (
+	"context"
 	"fmt"
+	"go/token"
+	"go/types"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/ssa"
 	"golang.org/x/tools/go/ssa/ssautil"
-	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
 	"strings"
 )
 
@@ -18,20 +25,160 @@ const (
 	REH  = "ResourceEventHandlerFuncs"
 )
 
+// DefaultRegistrationAPIs are the methods of the informers registering the handlers.
+var DefaultRegistrationAPIs = []string{"AddEventHandler", "AddEventHandlerWithResyncPeriod"}
+
+// Filter selects the entry points to collect. The empty fields select everything.
+type Filter struct {
+	// Handler matches the whole name of the handler or trigger, e.g. "addPod|updatePod".
+	Handler *regexp.Regexp
+	// Kinds are the kinds of the informers, see InformerKind. The triggers
+	// which are not registered to an informer have no kind.
+	Kinds []string
+	// Events are the events of the handlers, or the Periodic and Requeue triggers.
+	Events []string
+}
+
+// LoadConfig is how the packages are loaded: where, and the build configuration,
+// which selects the files of the packages and so the handlers which exist.
+type LoadConfig struct {
+	// Dir is the directory the patterns are loaded from, e.g. the root of a Kubernetes
+	// checkout in module mode. The current directory when empty.
+	Dir string
+	// Tags are the build tags, e.g. "providerless".
+	Tags []string
+	// GOOS and GOARCH are the target platform, the one of the go command when empty.
+	GOOS   string
+	GOARCH string
+	// Tests loads the test files too, see PackageOf.
+	Tests bool
+	// Env are more environment variables of the go command, e.g. "CGO_ENABLED=0".
+	Env []string
+}
+
+// Platform returns the target platform of the config: its GOOS and GOARCH, else the
+// ones of the go command run with the Dir and the environment of the load, which
+// include those set by go env -w, else the ones kubetorch is built for.
+func (cfg LoadConfig) Platform() (goos, goarch string) {
+	if cfg.GOOS != "" && cfg.GOARCH != "" {
+		return cfg.GOOS, cfg.GOARCH
+	}
+	cmd := exec.Command("go", "env", "GOOS", "GOARCH")
+	cmd.Dir = cfg.Dir
+	cmd.Env = cfg.environ()
+	if out, err := cmd.Output(); err == nil {
+		if fields := strings.Fields(string(out)); len(fields) == 2 {
+			return fields[0], fields[1]
+		}
+	}
+	if cfg.GOOS != "" {
+		return cfg.GOOS, runtime.GOARCH
+	}
+	if cfg.GOARCH != "" {
+		return runtime.GOOS, cfg.GOARCH
+	}
+	return runtime.GOOS, runtime.GOARCH
+}
+
+// environ returns the environment of the go command.
+func (cfg LoadConfig) environ() []string {
+	env := append(os.Environ(), cfg.Env...)
+	if cfg.GOOS != "" {
+		env = append(env, "GOOS="+cfg.GOOS)
+	}
+	if cfg.GOARCH != "" {
+		env = append(env, "GOARCH="+cfg.GOARCH)
+	}
+	return env
+}
+
+// packagesConfig returns the config of packages.Load.
+func (cfg LoadConfig) packagesConfig(ctx context.Context) *packages.Config {
+	env := cfg.environ()
+	var flags []string
+	if len(cfg.Tags) != 0 {
+		flags = append(flags, "-tags="+strings.Join(cfg.Tags, ","))
+	}
+	return &packages.Config{
+		Context:    ctx,
+		Mode:       packages.LoadAllSyntax,
+		Dir:        cfg.Dir,
+		Env:        env,
+		BuildFlags: flags,
+		Tests:      cfg.Tests,
+	}
+}
+
+// Entry is an entry point: a handler registered for an event of an informer,
+// or the function driven by a Periodic or Requeue trigger.
+type Entry struct {
+	// Call registers the handler, or starts the trigger
+	Call ssa.CallInstruction
+	// API is the name of the method or function called, e.g. "AddEventHandler" or "Until"
+	API string
+	// Kind is the kind of the informer, see InformerKind
+	Kind    string
+	Event   string
+	Handler *ssa.Function
+}
+
+// Diagnostic is a construct skipped by the analysis: where, in which function, and why.
+type Diagnostic struct {
+	Position token.Position
+	Function string
+	Reason   string
+}
+
+func (d Diagnostic) String() string {
+	if d.Function == "" {
+		return fmt.Sprintf("%v: %s", d.Position, d.Reason)
+	}
+	return fmt.Sprintf("%v: %s: %s", d.Position, d.Function, d.Reason)
+}
+
 type Collector struct {
-	pattern    string
-	prog       *ssa.Program
-	handlerMap map[*ssa.Call]map[string]*ssa.Function
+	pattern string
+	prog    *ssa.Program
+	// diagnostics are the registrations skipped
+	diagnostics []Diagnostic
+	// registrars are the functions registering the handlers, all the functions of the package when empty
+	registrars       []string
+	registrationAPIs []string
+	filter           Filter
+	load             LoadConfig
+	handlerMap       map[*ssa.Call]map[string]*ssa.Function
+	// triggerMap holds the entry points not caused by watch events, see trigger.go
+	triggerMap map[ssa.CallInstruction]map[string]*ssa.Function
 }
 
-func (c *Collector) extractFREHandlers(root *ssa.Alloc) map[string]*ssa.Function {
-	fa := (*root.Referrers())[1].(*ssa.FieldAddr)
-	st := (*fa.Referrers())[0].(*ssa.Store)
-	allocHandler := st.Val.(*ssa.MakeInterface).X.(*ssa.UnOp).X.(*ssa.Alloc)
-	return c.extractREHandlers(allocHandler)
+// extractFREHandlers returns the handlers of the FilteringResourceEventHandler
+// allocated by root, registered by the call of fun. Its Handler field holds the
+// ResourceEventHandlerFuncs.
+func (c *Collector) extractFREHandlers(fun *ssa.Function, call *ssa.Call, root *ssa.Alloc) map[string]*ssa.Function {
+	for _, instr := range *root.Referrers() {
+		fa, ok := instr.(*ssa.FieldAddr)
+		if !ok || fa.Field != 1 {
+			continue
+		}
+		st := storeTo(fa)
+		if st == nil {
+			c.diagnose(fun, call.Pos(), "the Handler of the %s is not stored", FREH)
+			return nil
+		}
+		allocHandler := allocOf(st.Val)
+		if allocHandler == nil || !strings.HasSuffix(allocHandler.Type().String(), REH) {
+			c.diagnose(fun, call.Pos(), "unsupported Handler %v of the %s", st.Val, FREH)
+			return nil
+		}
+		return c.extractREHandlers(fun, call, allocHandler)
+	}
+	c.diagnose(fun, call.Pos(), "the %s has no Handler", FREH)
+	return nil
 }
 
-func (c *Collector) extractREHandlers(root *ssa.Alloc) map[string]*ssa.Function {
+// extractREHandlers returns the handlers of the ResourceEventHandlerFuncs allocated
+// by root, registered by the call of fun.
+func (c *Collector) extractREHandlers(fun *ssa.Function, call *ssa.Call, root *ssa.Alloc) map[string]*ssa.Function {
 	m := map[string]*ssa.Function{}
 
 	handlerType := func(s string) string {
@@ -51,18 +198,61 @@ func (c *Collector) extractREHandlers(root *ssa.Alloc) map[string]*ssa.Function
 		if !ok {
 			continue
 		}
-		st := (*fa.Referrers())[0].(*ssa.Store)
-		m[handlerType(fa.String())] = st.Val.(*ssa.MakeClosure).Fn.(*ssa.Function)
+		st := storeTo(fa)
+		if st == nil {
+			c.diagnose(fun, fa.Pos(), "the %s handler is not stored", handlerType(fa.String()))
+			continue
+		}
+		fn := FuncOf(st.Val)
+		if fn == nil {
+			c.diagnose(fun, st.Pos(), "unsupported %s handler %v", handlerType(fa.String()), st.Val)
+			continue
+		}
+		m[handlerType(fa.String())] = fn
 	}
-	//fmt.Println(m)
 	return m
 }
 
+// storeTo returns the store to the address fa, if it is its first referrer.
+func storeTo(fa *ssa.FieldAddr) *ssa.Store {
+	if len(*fa.Referrers()) == 0 {
+		return nil
+	}
+	st, ok := (*fa.Referrers())[0].(*ssa.Store)
+	if !ok || st.Addr != fa {
+		return nil
+	}
+	return st
+}
+
+// allocOf returns the allocation of the struct converted to the interface v, e.g.
+// the cache.ResourceEventHandlerFuncs{...} passed to AddEventHandler.
+func allocOf(v ssa.Value) *ssa.Alloc {
+	mi, ok := v.(*ssa.MakeInterface)
+	if !ok {
+		return nil
+	}
+	uo, ok := mi.X.(*ssa.UnOp)
+	if !ok || uo.Op != token.MUL {
+		return nil
+	}
+	alloc, _ := uo.X.(*ssa.Alloc)
+	return alloc
+}
+
+// diagnose records a construct skipped in fun at pos.
+func (c *Collector) diagnose(fun *ssa.Function, pos token.Pos, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Position: c.prog.Fset.Position(pos),
+		Function: fun.String(),
+		Reason:   fmt.Sprintf(format, args...),
+	})
+}
+
 func (c *Collector) extractHandlers(prog *ssa.Program, pattern string) map[*ssa.Call]map[string]*ssa.Function {
 	m := map[*ssa.Call]map[string]*ssa.Function{}
-	for _, pkg := range prog.AllPackages() {
-		if pkg.Pkg.Path() == pattern {
-			fun := pkg.Func("addAllEventHandlers") // Hardcoded here. Relax it later.
+	if pkg := PackageOf(prog, pattern); pkg != nil {
+		for _, fun := range c.registrarsOf(prog, pkg) {
 			//fun.WriteTo(os.Stdout)
 			for _, block := range fun.Blocks {
 				for _, instr := range block.Instrs {
@@ -70,49 +260,205 @@ func (c *Collector) extractHandlers(prog *ssa.Program, pattern string) map[*ssa.
 					if !ok {
 						continue
 					}
-					if call.Common().IsInvoke() && call.Common().Method.Name() == "AddEventHandler" { // Hardcoded here. Relax it later.
-						//fmt.Println(call)
-						switch call.Common().Args[0].(type) {
-						case *ssa.MakeInterface:
-							mi := call.Common().Args[0].(*ssa.MakeInterface)
-							allocHandler := mi.X.(*ssa.UnOp).X.(*ssa.Alloc)
-							allocHandler.Pos()
-							handlerType := allocHandler.Type().String()
-							if strings.HasSuffix(handlerType, FREH) {
-								//fmt.Println("handle FilteringResourceEventHandler")
-								m[call] = c.extractFREHandlers(allocHandler)
-							} else if strings.HasSuffix(handlerType, REH) {
-								//fmt.Println("handle ResourceEventHandlerFunc")
-								m[call] = c.extractREHandlers(allocHandler)
-							}
-						default:
-							fmt.Println("doesn't support")
+					if !call.Common().IsInvoke() || !Contains(c.registrationAPIs, call.Common().Method.Name()) || len(call.Common().Args) == 0 {
+						continue
+					}
+					allocHandler := allocOf(call.Common().Args[0])
+					if allocHandler == nil {
+						c.diagnose(fun, call.Pos(), "unsupported handler %v registered by %s", call.Common().Args[0], call.Common().Method.Name())
+						continue
+					}
+					handlerType := allocHandler.Type().String()
+					if strings.HasSuffix(handlerType, FREH) {
+						if handlers := c.extractFREHandlers(fun, call, allocHandler); handlers != nil {
+							m[call] = handlers
 						}
+					} else if strings.HasSuffix(handlerType, REH) {
+						m[call] = c.extractREHandlers(fun, call, allocHandler)
+					} else {
+						c.diagnose(fun, call.Pos(), "unsupported handler %s registered by %s", handlerType, call.Common().Method.Name())
 					}
 				}
 			}
 		}
 	}
-	//fmt.Println(m)
 	return m
 }
 
-func (c *Collector) CollectEntryPoints() {
-	cfg := packages.Config{Mode: packages.LoadAllSyntax}
-	initial, err := packages.Load(&cfg, c.pattern)
+// registrarsOf returns the functions of pkg registering the handlers.
+func (c *Collector) registrarsOf(prog *ssa.Program, pkg *ssa.Package) []*ssa.Function {
+	if len(c.registrars) == 0 {
+		return PackageFunctions(prog, pkg)
+	}
+	funs := []*ssa.Function{}
+	for _, name := range c.registrars {
+		if fun := pkg.Func(name); fun != nil {
+			funs = append(funs, fun)
+		}
+	}
+	return funs
+}
+
+// Contains tells whether list has s.
+func Contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// selects tells whether the filter selects the entry point fn of the event,
+// registered by the call of an informer of the kind.
+func (f Filter) selects(kind, event string, fn *ssa.Function) bool {
+	if f.Handler != nil && !f.Handler.MatchString(strings.TrimSuffix(fn.Name(), "$bound")) {
+		return false
+	}
+	if len(f.Kinds) != 0 && !Contains(f.Kinds, kind) {
+		return false
+	}
+	return len(f.Events) == 0 || Contains(f.Events, event)
+}
+
+// applyFilter removes the entry points not selected by the filter.
+func (c *Collector) applyFilter() {
+	for call, handlers := range c.handlerMap {
+		for event, fn := range handlers {
+			if !c.filter.selects(InformerKind(call), event, fn) {
+				delete(handlers, event)
+			}
+		}
+		if len(handlers) == 0 {
+			delete(c.handlerMap, call)
+		}
+	}
+	for instr, triggers := range c.triggerMap {
+		kind := ""
+		if call, ok := instr.(*ssa.Call); ok && call.Common().IsInvoke() && Contains(c.registrationAPIs, call.Common().Method.Name()) {
+			kind = InformerKind(call)
+		}
+		for trigger, fn := range triggers {
+			if !c.filter.selects(kind, trigger, fn) {
+				delete(triggers, trigger)
+			}
+		}
+		if len(triggers) == 0 {
+			delete(c.triggerMap, instr)
+		}
+	}
+}
+
+// SetRegistrars sets the names of the functions registering the handlers,
+// e.g. addAllEventHandlers. All the functions of the package are searched when it is empty.
+func (c *Collector) SetRegistrars(names ...string) {
+	c.registrars = names
+}
+
+// SetRegistrationAPIs sets the methods registering the handlers, see DefaultRegistrationAPIs.
+func (c *Collector) SetRegistrationAPIs(names ...string) {
+	c.registrationAPIs = names
+}
+
+// SetFilter sets the filter of the entry points to collect.
+func (c *Collector) SetFilter(f Filter) {
+	c.filter = f
+}
+
+// SetLoadConfig sets how CollectEntryPoints loads the package, and the config reported
+// when the program is loaded by the caller.
+func (c *Collector) SetLoadConfig(cfg LoadConfig) {
+	c.load = cfg
+}
+
+// CollectEntryPoints loads the package of the collector and collects its entry points.
+// The pattern of the collector may be a directory, e.g. "./pkg/controller", which is
+// replaced by the import path of the package it matches.
+func (c *Collector) CollectEntryPoints() error {
+	prog, paths, err := LoadPackages(context.Background(), c.load, c.pattern)
+	if err != nil {
+		return err
+	}
+	if len(paths) != 1 {
+		return fmt.Errorf("pattern %s matches %d packages instead of 1", c.pattern, len(paths))
+	}
+	c.pattern = paths[0]
+	c.Collect(prog)
+	return nil
+}
+
+// Load builds the program of the packages matching the patterns, see LoadPackages.
+func Load(ctx context.Context, load LoadConfig, patterns ...string) (*ssa.Program, error) {
+	prog, _, err := LoadPackages(ctx, load, patterns...)
+	return prog, err
+}
+
+// LoadPackages builds the program of the packages matching the patterns, which are the
+// patterns of go list, e.g. "./pkg/...", and returns the import paths of these packages.
+// The errors of the packages matched, and patterns matching nothing, are returned.
+func LoadPackages(ctx context.Context, load LoadConfig, patterns ...string) (*ssa.Program, []string, error) {
+	initial, err := packages.Load(load.packagesConfig(ctx), patterns...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
+	}
+	paths := []string{}
+	found := map[string]struct{}{}
+	for _, pkg := range initial {
+		if len(pkg.Errors) != 0 {
+			return nil, nil, fmt.Errorf("loading %s: %v", pkg.PkgPath, pkg.Errors[0])
+		}
+		// a package and its test variant have the same path, and the test main has no entry points
+		if _, dup := found[pkg.PkgPath]; dup || strings.HasSuffix(pkg.PkgPath, ".test") {
+			continue
+		}
+		found[pkg.PkgPath] = struct{}{}
+		paths = append(paths, pkg.PkgPath)
+	}
+	if len(paths) == 0 {
+		return nil, nil, fmt.Errorf("no packages match %s", strings.Join(patterns, " "))
 	}
 	prog, _ := ssautil.AllPackages(initial, 0)
 	prog.Build()
+	return prog, paths, nil
+}
+
+// PackageOf returns the package of prog with the path, or nil. When the tests are
+// loaded, a package and its test variant have the same path: the test variant, which
+// has the members of the package and of its tests, is returned.
+func PackageOf(prog *ssa.Program, path string) *ssa.Package {
+	var found *ssa.Package
+	for _, pkg := range prog.AllPackages() {
+		if pkg.Pkg.Path() == path && (found == nil || len(pkg.Members) > len(found.Members)) {
+			found = pkg
+		}
+	}
+	return found
+}
+
+// Collect collects the entry points of the package of the collector in prog,
+// which is shared by the collectors of several components.
+func (c *Collector) Collect(prog *ssa.Program) {
 	c.prog = prog
+	c.diagnostics = nil
 	c.handlerMap = c.extractHandlers(prog, c.pattern)
+	c.triggerMap = c.extractTriggers(prog, c.pattern)
+	// a resync delivers the cached objects to the Update handler periodically
+	for call, handlers := range c.handlerMap {
+		if update, ok := handlers["Update"]; ok && call.Common().Method.Name() == "AddEventHandlerWithResyncPeriod" {
+			c.triggerMap[call] = map[string]*ssa.Function{Periodic: update}
+		}
+	}
+	c.applyFilter()
 }
 
 func (c *Collector) GetPattern() string {
 	return c.pattern
 }
 
+func (c *Collector) GetLoadConfig() LoadConfig {
+	return c.load
+}
+
 func (c *Collector) GetProg() *ssa.Program {
 	return c.prog
 }
@@ -121,10 +467,96 @@ func (c *Collector) GetHandlerMap() map[*ssa.Call]map[string]*ssa.Function {
 	return c.handlerMap
 }
 
+func (c *Collector) GetTriggerMap() map[ssa.CallInstruction]map[string]*ssa.Function {
+	return c.triggerMap
+}
+
+// Entries returns the entry points collected, by position of their calls and by event.
+func (c *Collector) Entries() []Entry {
+	entries := []Entry{}
+	for call, handlers := range c.handlerMap {
+		for event, fn := range handlers {
+			entries = append(entries, Entry{Call: call, API: nameOf(call.Common()), Kind: InformerKind(call), Event: event, Handler: fn})
+		}
+	}
+	for instr, triggers := range c.triggerMap {
+		kind := ""
+		if call, ok := instr.(*ssa.Call); ok && c.handlerMap[call] != nil {
+			kind = InformerKind(call)
+		}
+		for trigger, fn := range triggers {
+			entries = append(entries, Entry{Call: instr, API: nameOf(instr.Common()), Kind: kind, Event: trigger, Handler: fn})
+		}
+	}
+	// the files are not added to the fileset in a stable order, positions are compared by file
+	sort.Slice(entries, func(i, j int) bool {
+		pi, pj := c.prog.Fset.Position(entries[i].Call.Pos()), c.prog.Fset.Position(entries[j].Call.Pos())
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		if pi.Offset != pj.Offset {
+			return pi.Offset < pj.Offset
+		}
+		if entries[i].Event != entries[j].Event {
+			return entries[i].Event < entries[j].Event
+		}
+		return entries[i].Handler.String() < entries[j].Handler.String()
+	})
+	return entries
+}
+
+// Diagnostics returns the constructs skipped while collecting the entry points.
+func (c *Collector) Diagnostics() []Diagnostic {
+	return c.diagnostics
+}
+
+// InformerKind returns the kind of the objects of the informer the handlers are
+// registered to, e.g. "Pod" for podInformer.Informer().AddEventHandler(...).
+// It is empty when the informer is not typed.
+func InformerKind(registration *ssa.Call) string {
+	recv := registration.Common().Value
+	if call, ok := recv.(*ssa.Call); ok && call.Common().IsInvoke() && call.Common().Method.Name() == "Informer" {
+		recv = call.Common().Value
+	}
+	typ := recv.Type()
+	if ptr, ok := typ.Underlying().(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return ""
+	}
+	name := named.Obj().Name()
+	if !strings.HasSuffix(name, "Informer") || strings.HasPrefix(name, "Shared") {
+		return ""
+	}
+	return strings.TrimSuffix(name, "Informer")
+}
+
+// CollectComponents collects the entry points of several components, e.g. the scheduler
+// and a controller, loaded in the same program with load. There is one collector per
+// package matched.
+func CollectComponents(ctx context.Context, load LoadConfig, patterns ...string) ([]*Collector, error) {
+	prog, paths, err := LoadPackages(ctx, load, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	collectors := []*Collector{}
+	for _, path := range paths {
+		c := NewCollector(path)
+		c.SetLoadConfig(load)
+		c.Collect(prog)
+		collectors = append(collectors, c)
+	}
+	return collectors, nil
+}
+
 func NewCollector(pattern string) *Collector {
 	c := &Collector{
-		pattern:    pattern,
-		handlerMap: map[*ssa.Call]map[string]*ssa.Function{},
+		pattern:          pattern,
+		registrationAPIs: DefaultRegistrationAPIs,
+		handlerMap:       map[*ssa.Call]map[string]*ssa.Function{},
+		triggerMap:       map[ssa.CallInstruction]map[string]*ssa.Function{},
 	}
 	return c
 }
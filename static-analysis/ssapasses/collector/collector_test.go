@@ -5,12 +5,19 @@
 package collector
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"testing"
 )
 
 func TestCollector(t *testing.T) {
 	c := NewCollector("kubetorch/ssapasses/collector/testdata")
-	c.CollectEntryPoints()
+	if err := c.CollectEntryPoints(); err != nil {
+		t.Fatal(err)
+	}
 	m := c.GetHandlerMap()
 	if len(m) != 2 {
 		t.Errorf("entry point map len should be 2, but %d actually", len(m))
@@ -22,3 +29,200 @@ func TestCollector(t *testing.T) {
 		}
 	}
 }
+
+func TestTriggers(t *testing.T) {
+	c := NewCollector("kubetorch/ssapasses/collector/testdata/triggers")
+	if err := c.CollectEntryPoints(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.GetHandlerMap()) != 1 {
+		t.Errorf("entry point map len should be 1, but %d actually", len(c.GetHandlerMap()))
+	}
+
+	found := map[string]string{}
+	for _, subm := range c.GetTriggerMap() {
+		for trigger, fn := range subm {
+			found[fn.Name()] = trigger
+		}
+	}
+	expected := map[string]string{
+		"worker$bound":        Periodic,
+		"gc":                  Periodic,
+		"handleErr":           Requeue,
+		"updateHandler$bound": Periodic,
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("triggers should be %v, but %v actually", expected, found)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	c := NewCollector("kubetorch/ssapasses/collector/testdata/triggers")
+	c.SetRegistrars("addAllEventHandlers")
+	c.SetFilter(Filter{Handler: regexp.MustCompile("worker|updateHandler"), Events: []string{Periodic, "Update"}})
+	if err := c.CollectEntryPoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers := map[string]string{}
+	for _, subm := range c.GetHandlerMap() {
+		for event, fn := range subm {
+			handlers[fn.Name()] = event
+		}
+	}
+	if expected := map[string]string{"updateHandler$bound": "Update"}; !reflect.DeepEqual(handlers, expected) {
+		t.Errorf("handlers should be %v, but %v actually", expected, handlers)
+	}
+	triggers := map[string]string{}
+	for _, subm := range c.GetTriggerMap() {
+		for trigger, fn := range subm {
+			triggers[fn.Name()] = trigger
+		}
+	}
+	expected := map[string]string{
+		"worker$bound":        Periodic,
+		"updateHandler$bound": Periodic,
+	}
+	if !reflect.DeepEqual(triggers, expected) {
+		t.Errorf("triggers should be %v, but %v actually", expected, triggers)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	c := NewCollector("kubetorch/ssapasses/collector/testdata/triggers")
+	if err := c.CollectEntryPoints(); err != nil {
+		t.Fatal(err)
+	}
+	entries := []string{}
+	for _, e := range c.Entries() {
+		entries = append(entries, e.API+" "+e.Event+" "+e.Handler.Name())
+	}
+	// by position of the calls, the registration being the last one
+	expected := []string{
+		"AddRateLimited Requeue handleErr",
+		"NewTicker Periodic gc",
+		"Until Periodic worker$bound",
+		"AddEventHandlerWithResyncPeriod Add addHandler$bound",
+		"AddEventHandlerWithResyncPeriod Delete deleteHandler$bound",
+		"AddEventHandlerWithResyncPeriod Periodic updateHandler$bound",
+		"AddEventHandlerWithResyncPeriod Update updateHandler$bound",
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries should be %v, but %v actually", expected, entries)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	c := NewCollector("kubetorch/ssapasses/collector/testdata/missing")
+	if err := c.CollectEntryPoints(); err == nil {
+		t.Error("a package matching nothing should be an error")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := NewCollector("kubetorch/ssapasses/collector/testdata/malformed")
+	if err := c.CollectEntryPoints(); err != nil {
+		t.Fatal(err)
+	}
+	entries := []string{}
+	for _, e := range c.Entries() {
+		entries = append(entries, e.Event+" "+e.Handler.Name())
+	}
+	if expected := []string{"Add addHandler$bound"}; !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries should be %v, but %v actually", expected, entries)
+	}
+	reasons := []string{}
+	for _, d := range c.Diagnostics() {
+		if d.Function != "kubetorch/ssapasses/collector/testdata/malformed.addEventHandlers" || d.Position.Line == 0 {
+			t.Errorf("the diagnostic should be positioned in addEventHandlers, but %v actually", d)
+		}
+		reasons = append(reasons, d.Reason)
+	}
+	sort.Strings(reasons)
+	expected := []string{
+		"unsupported Delete handler parameter deleteFunc : func(obj interface{})",
+		"unsupported Handler parameter handler : ResourceEventHandler of the FilteringResourceEventHandler",
+		"unsupported handler parameter handler : ResourceEventHandler registered by AddEventHandler",
+	}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("reasons should be %v, but %v actually", expected, reasons)
+	}
+}
+
+func TestLoadConfigDir(t *testing.T) {
+	c := NewCollector("example.com/module/controller")
+	c.SetLoadConfig(LoadConfig{Dir: "testdata/module"})
+	if err := c.CollectEntryPoints(); err != nil {
+		t.Fatal(err)
+	}
+	entries := c.Entries()
+	if len(entries) != 1 || entries[0].Event != "Add" || entries[0].Handler.Name() != "addPod" {
+		t.Errorf("addPod should be collected, but %v actually", entries)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	for _, test := range []struct {
+		path, model string
+		match       bool
+	}{
+		{"k8s.io/api/core/v1.Binding", "k8s.io/api/core/v1.Binding", true},
+		{"k8s.io/kubernetes/vendor/k8s.io/api/core/v1.Binding", "k8s.io/api/core/v1.Binding", true},
+		{"k8s.io/api/core/v1.Binding", "k8s.io/kubernetes/vendor/k8s.io/api/core/v1.Binding", true},
+		{"kubetorch/testdata/k8s.io/client-go/util/workqueue", "k8s.io/client-go/util/workqueue", true},
+		{"k8s.io/client-go/listers/core/v1", "k8s.io/client-go/listers/", true},
+		{"vendor/k8s.io/client-go/listers/core/v1", "k8s.io/client-go/listers/", true},
+		{"k8s.io/api/core/v1.BindingList", "k8s.io/api/core/v1.Binding", false},
+		{"example.com/myk8s.io/api/core/v1.Binding", "k8s.io/api/core/v1.Binding", false},
+		{"example.com/myvendor/k8s.io/api/core/v1.Binding", "k8s.io/api/core/v1.Binding", false},
+		{"github.com/pkg/errors", "errors", false},
+		{"example.com/k8s.io/client-go/listers/core/v1", "k8s.io/client-go/listers/", false},
+	} {
+		if match := MatchPath(test.path, test.model); match != test.match {
+			t.Errorf("MatchPath(%q, %q) should be %v, but %v actually", test.path, test.model, test.match, match)
+		}
+	}
+	s := "(*k8s.io/kubernetes/vendor/k8s.io/client-go/tools/record.recorder).Event(map[string]k8s.io/kubernetes/vendor/k8s.io/api/core/v1.Pod)"
+	if expected := "(*k8s.io/client-go/tools/record.recorder).Event(map[string]k8s.io/api/core/v1.Pod)"; TrimVendor(s) != expected {
+		t.Errorf("TrimVendor should be %s, but %s actually", expected, TrimVendor(s))
+	}
+	if expected := "example.com/myvendor/x"; TrimVendor(expected) != expected {
+		t.Errorf("TrimVendor should keep %s, but %s actually", expected, TrimVendor(expected))
+	}
+}
+
+func TestLoadConfigBuild(t *testing.T) {
+	for _, test := range []struct {
+		cfg      LoadConfig
+		handlers []string
+	}{
+		{LoadConfig{GOOS: "linux"}, []string{"addLinux"}},
+		{LoadConfig{GOOS: "windows", Tags: []string{"providerless"}}, []string{"addProviderless", "addWindows"}},
+		{LoadConfig{Env: []string{"GOOS=windows"}, Tests: true}, []string{"addTest", "addWindows"}},
+	} {
+		c := NewCollector("kubetorch/ssapasses/collector/testdata/platform")
+		c.SetLoadConfig(test.cfg)
+		if err := c.CollectEntryPoints(); err != nil {
+			t.Fatal(err)
+		}
+		handlers := []string{}
+		for _, e := range c.Entries() {
+			handlers = append(handlers, e.Handler.Name())
+		}
+		sort.Strings(handlers)
+		if !reflect.DeepEqual(handlers, test.handlers) {
+			t.Errorf("the handlers of %+v should be %v, but %v actually", test.cfg, test.handlers, handlers)
+		}
+	}
+	if goos, _ := (LoadConfig{Env: []string{"GOOS=windows"}}).Platform(); goos != "windows" {
+		t.Errorf("the GOOS of the env should be windows, but %s actually", goos)
+	}
+	// the platform set by go env -w, in the GOENV file
+	goenv := filepath.Join(t.TempDir(), "env")
+	if err := ioutil.WriteFile(goenv, []byte("GOOS=plan9\nGOARCH=arm\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if goos, goarch := (LoadConfig{Env: []string{"GOENV=" + goenv, "GOOS=", "GOARCH="}}).Platform(); goos != "plan9" || goarch != "arm" {
+		t.Errorf("the platform of go env should be plan9/arm, but %s/%s actually", goos, goarch)
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package wait
+
+import (
+	"time"
+)
+
+func Until(f func(), period time.Duration, stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		f()
+		time.Sleep(period)
+	}
+}
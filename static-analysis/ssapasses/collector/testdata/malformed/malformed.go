@@ -0,0 +1,62 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+// Package malformed registers handlers in shapes the collector does not support.
+package malformed
+
+type ResourceEventHandler interface {
+	do(obj interface{})
+}
+
+type ResourceEventHandlerFuncs struct {
+	AddFunc    func(obj interface{})
+	UpdateFunc func(oldObj, newObj interface{})
+	DeleteFunc func(obj interface{})
+}
+
+func (r ResourceEventHandlerFuncs) do(obj interface{}) {
+
+}
+
+type FilteringResourceEventHandler struct {
+	FilterFunc func(obj interface{}) bool
+	Handler    ResourceEventHandler
+}
+
+func (f FilteringResourceEventHandler) do(obj interface{}) {
+
+}
+
+type informer interface {
+	AddEventHandler(handler ResourceEventHandler)
+}
+
+type controller struct {
+	items []interface{}
+}
+
+// addHandler reads and writes items through the same field address.
+func (c *controller) addHandler(obj interface{}) {
+	items := &c.items
+	*items = append(*items, obj)
+	c.reset()
+}
+
+// reset has no body, e.g. it is implemented in assembly.
+func (c *controller) reset()
+
+func addEventHandlers(c *controller, i informer, handler ResourceEventHandler, deleteFunc func(obj interface{})) {
+	// the handler is not built here
+	i.AddEventHandler(handler)
+	// the Handler of the filtering handler is not built here
+	i.AddEventHandler(FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool { return true },
+		Handler:    handler,
+	})
+	// the DeleteFunc is not a function known here, the AddFunc is still collected
+	i.AddEventHandler(ResourceEventHandlerFuncs{
+		AddFunc:    c.addHandler,
+		DeleteFunc: deleteFunc,
+	})
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+// Package controller is loaded from its own module, as a module-mode Kubernetes checkout.
+package controller
+
+type ResourceEventHandler interface {
+	do(obj interface{})
+}
+
+type ResourceEventHandlerFuncs struct {
+	AddFunc    func(obj interface{})
+	UpdateFunc func(oldObj, newObj interface{})
+	DeleteFunc func(obj interface{})
+}
+
+func (r ResourceEventHandlerFuncs) do(obj interface{}) {
+
+}
+
+type informer interface {
+	AddEventHandler(handler ResourceEventHandler)
+}
+
+func addPod(obj interface{}) {
+
+}
+
+func addEventHandlers(i informer) {
+	i.AddEventHandler(ResourceEventHandlerFuncs{
+		AddFunc: addPod,
+	})
+}
@@ -0,0 +1,24 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+// Package platform registers different handlers depending on the build configuration.
+package platform
+
+type ResourceEventHandler interface {
+	do(obj interface{})
+}
+
+type ResourceEventHandlerFuncs struct {
+	AddFunc    func(obj interface{})
+	UpdateFunc func(oldObj, newObj interface{})
+	DeleteFunc func(obj interface{})
+}
+
+func (r ResourceEventHandlerFuncs) do(obj interface{}) {
+
+}
+
+type informer interface {
+	AddEventHandler(handler ResourceEventHandler)
+}
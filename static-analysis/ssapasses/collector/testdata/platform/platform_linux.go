@@ -0,0 +1,13 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package platform
+
+func addLinux(obj interface{}) {
+
+}
+
+func registerLinux(i informer) {
+	i.AddEventHandler(ResourceEventHandlerFuncs{AddFunc: addLinux})
+}
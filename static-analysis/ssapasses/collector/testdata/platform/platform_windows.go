@@ -0,0 +1,13 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package platform
+
+func addWindows(obj interface{}) {
+
+}
+
+func registerWindows(i informer) {
+	i.AddEventHandler(ResourceEventHandlerFuncs{AddFunc: addWindows})
+}
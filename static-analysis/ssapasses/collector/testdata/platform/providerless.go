@@ -0,0 +1,16 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+//go:build providerless
+// +build providerless
+
+package platform
+
+func addProviderless(obj interface{}) {
+
+}
+
+func registerProviderless(i informer) {
+	i.AddEventHandler(ResourceEventHandlerFuncs{AddFunc: addProviderless})
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package triggers
+
+import (
+	"kubetorch/ssapasses/collector/testdata/k8s.io/apimachinery/pkg/util/wait"
+	"kubetorch/ssapasses/collector/testdata/k8s.io/client-go/util/workqueue"
+	"time"
+)
+
+type ResourceEventHandler interface {
+	do(obj interface{})
+}
+
+type ResourceEventHandlerFuncs struct {
+	AddFunc    func(obj interface{})
+	UpdateFunc func(oldObj, newObj interface{})
+	DeleteFunc func(obj interface{})
+}
+
+func (r ResourceEventHandlerFuncs) do(obj interface{}) {
+
+}
+
+type informer interface {
+	AddEventHandlerWithResyncPeriod(handler ResourceEventHandler, resyncPeriod time.Duration)
+}
+
+type controller struct {
+	queue workqueue.RateLimitingInterface
+}
+
+func (c *controller) addHandler(obj interface{}) {
+
+}
+
+func (c *controller) updateHandler(oldObj, newObj interface{}) {
+
+}
+
+func (c *controller) deleteHandler(obj interface{}) {
+
+}
+
+func (c *controller) worker() {
+
+}
+
+func (c *controller) handleErr(err error, key interface{}) {
+	if err != nil {
+		c.queue.AddRateLimited(key)
+	}
+}
+
+func (c *controller) gc() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+	}
+}
+
+func (c *controller) Run(stopCh <-chan struct{}) {
+	go wait.Until(c.worker, time.Second, stopCh)
+	<-stopCh
+}
+
+func addAllEventHandlers(c *controller, i informer) {
+	i.AddEventHandlerWithResyncPeriod(
+		ResourceEventHandlerFuncs{
+			AddFunc:    c.addHandler,
+			UpdateFunc: c.updateHandler,
+			DeleteFunc: c.deleteHandler,
+		},
+		time.Minute,
+	)
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package collector
+
+import (
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Triggers which are not caused by any watch event.
+const (
+	// Periodic behavior: wait.Until loops, tickers and informer resyncs.
+	Periodic = "Periodic"
+	// Requeue behavior: items put back into a workqueue with a delay.
+	Requeue = "Requeue"
+)
+
+const (
+	waitPkg      = "k8s.io/apimachinery/pkg/util/wait"
+	workqueuePkg = "k8s.io/client-go/util/workqueue"
+)
+
+// waitLoops are the functions of the wait package calling a function periodically.
+var waitLoops = map[string]struct{}{
+	"Until":                      {},
+	"UntilWithContext":           {},
+	"NonSlidingUntil":            {},
+	"NonSlidingUntilWithContext": {},
+	"JitterUntil":                {},
+	"JitterUntilWithContext":     {},
+	"BackoffUntil":               {},
+	"Forever":                    {},
+	"Poll":                       {},
+	"PollImmediate":              {},
+	"PollInfinite":               {},
+	"PollImmediateInfinite":      {},
+	"PollUntil":                  {},
+	"PollImmediateUntil":         {},
+}
+
+// requeues are the methods of the workqueues putting an item back later.
+var requeues = map[string]struct{}{
+	"AddAfter":       {},
+	"AddRateLimited": {},
+}
+
+// FuncOf returns the function behind a function value.
+func FuncOf(v ssa.Value) *ssa.Function {
+	switch v.(type) {
+	case *ssa.Function:
+		return v.(*ssa.Function)
+	case *ssa.MakeClosure:
+		fn, _ := v.(*ssa.MakeClosure).Fn.(*ssa.Function)
+		return fn
+	case *ssa.MakeInterface:
+		return FuncOf(v.(*ssa.MakeInterface).X)
+	case *ssa.ChangeType:
+		return FuncOf(v.(*ssa.ChangeType).X)
+	}
+	return nil
+}
+
+// pkgOf returns the path of the package declaring the function or method called.
+func pkgOf(common *ssa.CallCommon) string {
+	var typ types.Type
+	if common.IsInvoke() {
+		typ = common.Value.Type()
+	} else if callee := common.StaticCallee(); callee != nil {
+		if callee.Pkg != nil {
+			return callee.Pkg.Pkg.Path()
+		}
+		if recv := callee.Signature.Recv(); recv != nil {
+			typ = recv.Type()
+		}
+	}
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	if named, ok := typ.(*types.Named); ok && named.Obj().Pkg() != nil {
+		return named.Obj().Pkg().Path()
+	}
+	return ""
+}
+
+func nameOf(common *ssa.CallCommon) string {
+	if common.IsInvoke() {
+		return common.Method.Name()
+	}
+	if callee := common.StaticCallee(); callee != nil {
+		return callee.Name()
+	}
+	return ""
+}
+
+// extractTrigger returns the trigger started by the call, if any, and the function it drives.
+func (c *Collector) extractTrigger(instr ssa.CallInstruction) (string, *ssa.Function) {
+	common := instr.Common()
+	pkg, name := pkgOf(common), nameOf(common)
+	switch {
+	case MatchPath(pkg, waitPkg):
+		if _, ok := waitLoops[name]; !ok {
+			return "", nil
+		}
+		for _, arg := range common.Args {
+			if _, ok := arg.Type().Underlying().(*types.Signature); ok {
+				if fn := FuncOf(arg); fn != nil {
+					return Periodic, fn
+				}
+			}
+		}
+	case pkg == "time" && (name == "NewTicker" || name == "Tick"):
+		// the loop reading the ticker is in the caller
+		return Periodic, instr.Parent()
+	case MatchPath(pkg, workqueuePkg):
+		// the requeuing function is the trigger: it writes to the queue read by the workers
+		if _, ok := requeues[name]; ok {
+			return Requeue, instr.Parent()
+		}
+	}
+	return "", nil
+}
+
+// PackageFunctions returns the functions, methods and closures declared in pkg.
+func PackageFunctions(prog *ssa.Program, pkg *ssa.Package) []*ssa.Function {
+	funs := []*ssa.Function{}
+	var add func(fn *ssa.Function)
+	add = func(fn *ssa.Function) {
+		funs = append(funs, fn)
+		for _, anon := range fn.AnonFuncs {
+			add(anon)
+		}
+	}
+	for _, member := range pkg.Members {
+		switch member.(type) {
+		case *ssa.Function:
+			add(member.(*ssa.Function))
+		case *ssa.Type:
+			ms := prog.MethodSets.MethodSet(types.NewPointer(member.Type()))
+			for i := 0; i < ms.Len(); i++ {
+				if fn := prog.MethodValue(ms.At(i)); fn != nil && fn.Pkg == pkg {
+					add(fn)
+				}
+			}
+		}
+	}
+	return funs
+}
+
+func (c *Collector) extractTriggers(prog *ssa.Program, pattern string) map[ssa.CallInstruction]map[string]*ssa.Function {
+	m := map[ssa.CallInstruction]map[string]*ssa.Function{}
+	if pkg := PackageOf(prog, pattern); pkg != nil {
+		for _, fun := range PackageFunctions(prog, pkg) {
+			c.extractFunctionTriggers(fun, m)
+		}
+	}
+	return m
+}
+
+func (c *Collector) extractFunctionTriggers(fun *ssa.Function, m map[ssa.CallInstruction]map[string]*ssa.Function) {
+	for _, block := range fun.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(ssa.CallInstruction)
+			if !ok {
+				continue
+			}
+			if trigger, fn := c.extractTrigger(call); fn != nil {
+				m[call] = map[string]*ssa.Function{trigger: fn}
+			}
+		}
+	}
+}
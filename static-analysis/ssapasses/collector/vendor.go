@@ -0,0 +1,44 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package collector
+
+import (
+	"regexp"
+	"strings"
+)
+
+// vendorPrefix matches the prefix of a vendored package path, e.g. "k8s.io/kubernetes/vendor/",
+// preceded by the start of the string or by a character which is not part of a path.
+var vendorPrefix = regexp.MustCompile(`(^|[^\w.\-~/])((?:[\w.\-~]+/)*vendor/)`)
+
+// TrimVendor removes the vendor prefixes of the package paths in s, which may be a
+// package path, a qualified name or the string of a type or a function, e.g.
+// "*k8s.io/api/core/v1.Binding" for "*k8s.io/kubernetes/vendor/k8s.io/api/core/v1.Binding".
+// The packages of a module build are not prefixed, so that the models written
+// without the prefixes match the GOPATH, vendored and module builds alike.
+func TrimVendor(s string) string {
+	if !strings.Contains(s, "vendor/") {
+		return s
+	}
+	return vendorPrefix.ReplaceAllString(s, "$1")
+}
+
+// testdataPrefix matches the prefix of a copy of a package in testdata, e.g.
+// "kubetorch/ssapasses/tracker/testdata/" for the copies of the Kubernetes packages.
+var testdataPrefix = regexp.MustCompile(`(^|[^\w.\-~/])((?:[\w.\-~]+/)*testdata/)`)
+
+// MatchPath tells whether path, a package path or a qualified name, is the one of the
+// model once their vendor prefixes, and the testdata prefix of path, are removed. A model
+// ending with "/" matches the packages under it, e.g. "k8s.io/client-go/listers/".
+func MatchPath(path, model string) bool {
+	path, model = TrimVendor(path), TrimVendor(model)
+	if strings.Contains(path, "testdata/") {
+		path = testdataPrefix.ReplaceAllString(path, "$1")
+	}
+	if strings.HasSuffix(model, "/") {
+		return strings.HasPrefix(path, model)
+	}
+	return path == model
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ReadJSON reads a JSON document written by WriteJSON. The documents of other versions are errors.
+func ReadJSON(r io.Reader) (*Graph, error) {
+	g := &Graph{}
+	if err := json.NewDecoder(r).Decode(g); err != nil {
+		return nil, err
+	}
+	if g.Version != Version {
+		return nil, fmt.Errorf("unsupported version %q, expected %q", g.Version, Version)
+	}
+	return g, nil
+}
+
+// elements returns the nodes and the edges of the graph, keyed by their IDs.
+func (g *Graph) elements() map[string]struct{} {
+	elements := map[string]struct{}{}
+	elements["build "+g.Build.String()] = struct{}{}
+	for _, r := range g.Registrations {
+		elements["registration "+r.ID] = struct{}{}
+	}
+	for _, h := range g.Handlers {
+		elements["handler "+h.ID] = struct{}{}
+	}
+	for _, f := range g.Fields {
+		elements["field "+f.ID] = struct{}{}
+	}
+	for _, r := range g.ReadPoints {
+		elements["read point "+r.ID] = struct{}{}
+	}
+	for _, s := range g.Sinks {
+		elements["sink "+s.ID] = struct{}{}
+	}
+	for _, e := range g.Edges {
+		elements[fmt.Sprintf("edge %s -[%s %s]-> %s", e.From, e.Kind, e.Event, e.To)] = struct{}{}
+	}
+	return elements
+}
+
+// Diff returns the nodes and the edges removed from old ("- ...") and added in new ("+ ..."),
+// e.g. to compare two versions or two builds of a component.
+func Diff(old, new *Graph) []string {
+	before, after := old.elements(), new.elements()
+	diff := []string{}
+	for e := range before {
+		if _, found := after[e]; !found {
+			diff = append(diff, "- "+e)
+		}
+	}
+	for e := range after {
+		if _, found := before[e]; !found {
+			diff = append(diff, "+ "+e)
+		}
+	}
+	// sorted by element, the removal first
+	sort.Slice(diff, func(i, j int) bool {
+		if diff[i][2:] != diff[j][2:] {
+			return diff[i][2:] < diff[j][2:]
+		}
+		return diff[i] < diff[j]
+	})
+	return diff
+}
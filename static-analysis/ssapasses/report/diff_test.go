@@ -0,0 +1,57 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := exportGraph()
+	new := exportGraph()
+	new.Sinks = append(new.Sinks, Sink{ID: "sink:c", Resource: "Pod", Part: "object"})
+	new.Edges = append(new.Edges[:len(new.Edges)-1], Edge{From: "read:b", To: "sink:c", Kind: EdgeTaints, Event: "Update"})
+
+	var buf bytes.Buffer
+	if err := new.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"- edge read:b -[taints Update]-> sink:b",
+		"+ edge read:b -[taints Update]-> sink:c",
+		"+ sink sink:c",
+	}
+	if actual := Diff(old, decoded); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("diff should be %v, but %v actually", expected, actual)
+	}
+	if actual := Diff(old, exportGraph()); len(actual) != 0 {
+		t.Errorf("diff of the same graph should be empty, but %v actually", actual)
+	}
+
+	if _, err := ReadJSON(strings.NewReader(`{"version": "kubetorch/v0"}`)); err == nil {
+		t.Error("documents of other versions should not be read")
+	}
+}
+
+func TestDiffBuild(t *testing.T) {
+	linux := exportGraph()
+	linux.Build = Build{GOOS: "linux", GOARCH: "amd64"}
+	providerless := exportGraph()
+	providerless.Build = Build{Tags: []string{"providerless"}, GOOS: "linux", GOARCH: "amd64"}
+	expected := []string{
+		"- build linux/amd64",
+		"+ build linux/amd64 tags=providerless",
+	}
+	if actual := Diff(linux, providerless); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("diff should be %v, but %v actually", expected, actual)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ExportOptions select what an exported graph shows.
+type ExportOptions struct {
+	// Collapse merges the handlers, the fields and the workers of each controller into one node.
+	Collapse bool
+	// Kinds keeps the informers of these kinds only, and what they reach. All are kept when empty.
+	Kinds []string
+}
+
+// Kinds of the nodes of an exported graph.
+const (
+	nodeInformer   = "informer"
+	nodeHandler    = "handler"
+	nodeField      = "field"
+	nodeWorker     = "worker"
+	nodeSink       = "sink"
+	nodeController = "controller"
+)
+
+type viewNode struct {
+	kind  string
+	label string
+}
+
+type viewEdge struct {
+	from, to string
+	kind     string
+	events   []string
+}
+
+func (e viewEdge) label() string {
+	verb := map[string]string{
+		EdgeRegisters: "register",
+		EdgeWrites:    "write",
+		EdgeReads:     "read",
+		EdgeTaints:    "taint",
+		EdgeGuards:    "guard",
+	}[e.kind]
+	return fmt.Sprintf("%s: %s", verb, strings.Join(e.events, ", "))
+}
+
+// view is the graph of informers, handlers, fields, workers and sinks which is exported.
+// The read points are merged into the functions they are in, the workers.
+type view struct {
+	ids   []string
+	nodes map[string]viewNode
+	edges []*viewEdge
+}
+
+// shortName returns the name of a function without its package and receiver,
+// e.g. "processNextWorkItem" for "(*k8s.io/pkg.Controller).processNextWorkItem".
+func shortName(function string) string {
+	name := function[strings.LastIndex(function, "/")+1:]
+	name = name[strings.LastIndex(name, ".")+1:]
+	return strings.TrimSuffix(name, "$bound")
+}
+
+// view builds what is exported of the graph with the options.
+func (g *Graph) view(opts ExportOptions) *view {
+	v := &view{nodes: map[string]viewNode{}}
+	// the node each node of the graph is shown as, and its controller
+	shownAs := map[string]string{}
+	controllers := map[string]string{}
+	for _, r := range g.Registrations {
+		if r.Informer != "" {
+			shownAs[r.ID] = "informer:" + r.Informer
+			v.nodes[shownAs[r.ID]] = viewNode{kind: nodeInformer, label: r.Informer + " informer"}
+		} else {
+			shownAs[r.ID] = r.ID
+			v.nodes[r.ID] = viewNode{kind: nodeInformer, label: r.API}
+		}
+	}
+	for _, h := range g.Handlers {
+		shownAs[h.ID] = "handler:" + h.Function
+		controllers[h.ID] = h.Controller
+		v.nodes[shownAs[h.ID]] = viewNode{kind: nodeHandler, label: h.Name}
+	}
+	for _, f := range g.Fields {
+		shownAs[f.ID] = f.ID
+		controllers[f.ID] = f.Type
+		v.nodes[f.ID] = viewNode{kind: nodeField, label: shortName(f.Type) + "." + f.Name}
+	}
+	for _, r := range g.ReadPoints {
+		shownAs[r.ID] = "worker:" + r.Function
+		controllers[r.ID] = r.Controller
+		v.nodes[shownAs[r.ID]] = viewNode{kind: nodeWorker, label: shortName(r.Function)}
+	}
+	for _, s := range g.Sinks {
+		shownAs[s.ID] = s.ID
+		label := s.Resource + " " + s.Part
+		if s.Subresource != "" {
+			label = s.Resource + "/" + s.Subresource
+		}
+		v.nodes[s.ID] = viewNode{kind: nodeSink, label: label}
+	}
+	if opts.Collapse {
+		for id, controller := range controllers {
+			if controller == "" {
+				continue
+			}
+			delete(v.nodes, shownAs[id])
+			shownAs[id] = "controller:" + controller
+			v.nodes[shownAs[id]] = viewNode{kind: nodeController, label: shortName(controller)}
+		}
+	}
+
+	edges := map[[3]string]*viewEdge{}
+	for _, e := range g.Edges {
+		from, to := shownAs[e.From], shownAs[e.To]
+		if from == to {
+			continue
+		}
+		key := [3]string{from, to, e.Kind}
+		if edges[key] == nil {
+			edges[key] = &viewEdge{from: from, to: to, kind: e.Kind}
+			v.edges = append(v.edges, edges[key])
+		}
+		edges[key].events = appendEvent(edges[key].events, e.Event)
+	}
+	if len(opts.Kinds) != 0 {
+		v.keepReachable(opts.Kinds)
+	}
+	for id := range v.nodes {
+		v.ids = append(v.ids, id)
+	}
+	sort.Strings(v.ids)
+	sort.Slice(v.edges, func(i, j int) bool {
+		if v.edges[i].from != v.edges[j].from {
+			return v.edges[i].from < v.edges[j].from
+		}
+		if v.edges[i].to != v.edges[j].to {
+			return v.edges[i].to < v.edges[j].to
+		}
+		return v.edges[i].kind < v.edges[j].kind
+	})
+	return v
+}
+
+func appendEvent(events []string, event string) []string {
+	for _, e := range events {
+		if e == event {
+			return events
+		}
+	}
+	events = append(events, event)
+	sort.Strings(events)
+	return events
+}
+
+// keepReachable removes the nodes which are not reachable from the informers of the kinds.
+func (v *view) keepReachable(kinds []string) {
+	reached := map[string]struct{}{}
+	worklist := []string{}
+	for _, kind := range kinds {
+		id := "informer:" + kind
+		if _, found := v.nodes[id]; found {
+			reached[id] = struct{}{}
+			worklist = append(worklist, id)
+		}
+	}
+	for len(worklist) != 0 {
+		cur := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		for _, e := range v.edges {
+			if _, found := reached[e.to]; e.from == cur && !found {
+				reached[e.to] = struct{}{}
+				worklist = append(worklist, e.to)
+			}
+		}
+	}
+	for id := range v.nodes {
+		if _, found := reached[id]; !found {
+			delete(v.nodes, id)
+		}
+	}
+	edges := []*viewEdge{}
+	for _, e := range v.edges {
+		_, from := reached[e.from]
+		_, to := reached[e.to]
+		if from && to {
+			edges = append(edges, e)
+		}
+	}
+	v.edges = edges
+}
+
+// dotShapes are the shapes of the nodes in Graphviz.
+var dotShapes = map[string]string{
+	nodeInformer:   "ellipse",
+	nodeHandler:    "box",
+	nodeField:      "cylinder",
+	nodeWorker:     "component",
+	nodeSink:       "hexagon",
+	nodeController: "box3d",
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language.
+func (g *Graph) WriteDOT(w io.Writer, opts ExportOptions) error {
+	v := g.view(opts)
+	names := map[string]string{}
+	b := &strings.Builder{}
+	fmt.Fprintln(b, "digraph kubetorch {")
+	fmt.Fprintln(b, "  rankdir=LR;")
+	for i, id := range v.ids {
+		names[id] = fmt.Sprintf("n%d", i)
+		node := v.nodes[id]
+		fmt.Fprintf(b, "  %s [label=%q, shape=%s];\n", names[id], node.label, dotShapes[node.kind])
+	}
+	for _, e := range v.edges {
+		fmt.Fprintf(b, "  %s -> %s [label=%q];\n", names[e.from], names[e.to], e.label())
+	}
+	fmt.Fprintln(b, "}")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidShapes are the brackets around the labels of the nodes in Mermaid.
+var mermaidShapes = map[string][2]string{
+	nodeInformer:   {"([", "])"},
+	nodeHandler:    {"[", "]"},
+	nodeField:      {"[(", ")]"},
+	nodeWorker:     {"[[", "]]"},
+	nodeSink:       {"{{", "}}"},
+	nodeController: {"[/", "/]"},
+}
+
+// mermaidText quotes a label for Mermaid, which has no escape for the double quotes.
+func mermaidText(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart, e.g. to be embedded in markdown.
+func (g *Graph) WriteMermaid(w io.Writer, opts ExportOptions) error {
+	v := g.view(opts)
+	names := map[string]string{}
+	b := &strings.Builder{}
+	fmt.Fprintln(b, "flowchart LR")
+	for i, id := range v.ids {
+		names[id] = fmt.Sprintf("n%d", i)
+		node := v.nodes[id]
+		shape := mermaidShapes[node.kind]
+		fmt.Fprintf(b, "  %s%s%s%s\n", names[id], shape[0], mermaidText(node.label), shape[1])
+	}
+	for _, e := range v.edges {
+		fmt.Fprintf(b, "  %s -->|%s| %s\n", names[e.from], mermaidText(e.label()), names[e.to])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// exportGraph has two controllers: pods -> a.queue -> a.sync -> Pod status,
+// and nodes (Add and Update) -> b.queue -> b.sync -> Node spec.
+func exportGraph() *Graph {
+	return &Graph{
+		Version: Version,
+		Registrations: []Registration{
+			{ID: "registration:pods", API: "AddEventHandler", Informer: "Pod"},
+			{ID: "registration:nodes", API: "AddEventHandler", Informer: "Node"},
+		},
+		Handlers: []Handler{
+			{ID: "handler:addPod#Add", Name: "addPod", Function: "(*pkg.A).addPod$bound", Controller: "pkg.A", Event: "Add"},
+			{ID: "handler:addNode#Add", Name: "addNode", Function: "(*pkg.B).addNode$bound", Controller: "pkg.B", Event: "Add"},
+			{ID: "handler:updateNode#Update", Name: "updateNode", Function: "(*pkg.B).updateNode$bound", Controller: "pkg.B", Event: "Update"},
+		},
+		Fields: []Field{
+			{ID: "field:pkg.A.queue", Type: "pkg.A", Name: "queue", Queue: true},
+			{ID: "field:pkg.B.queue", Type: "pkg.B", Name: "queue", Queue: true},
+		},
+		ReadPoints: []ReadPoint{
+			{ID: "read:a", Function: "(*pkg.A).sync", Controller: "pkg.A"},
+			{ID: "read:b", Function: "(*pkg.B).sync", Controller: "pkg.B"},
+		},
+		Sinks: []Sink{
+			{ID: "sink:a", Resource: "Pod", Part: "status"},
+			{ID: "sink:b", Resource: "Node", Part: "spec"},
+		},
+		Edges: []Edge{
+			{From: "registration:pods", To: "handler:addPod#Add", Kind: EdgeRegisters, Event: "Add"},
+			{From: "handler:addPod#Add", To: "field:pkg.A.queue", Kind: EdgeWrites, Event: "Add"},
+			{From: "field:pkg.A.queue", To: "read:a", Kind: EdgeReads, Event: "Add"},
+			{From: "read:a", To: "sink:a", Kind: EdgeTaints, Event: "Add"},
+			{From: "registration:nodes", To: "handler:addNode#Add", Kind: EdgeRegisters, Event: "Add"},
+			{From: "registration:nodes", To: "handler:updateNode#Update", Kind: EdgeRegisters, Event: "Update"},
+			{From: "handler:addNode#Add", To: "field:pkg.B.queue", Kind: EdgeWrites, Event: "Add"},
+			{From: "handler:updateNode#Update", To: "field:pkg.B.queue", Kind: EdgeWrites, Event: "Update"},
+			{From: "field:pkg.B.queue", To: "read:b", Kind: EdgeReads, Event: "Add"},
+			{From: "field:pkg.B.queue", To: "read:b", Kind: EdgeReads, Event: "Update"},
+			{From: "read:b", To: "sink:b", Kind: EdgeTaints, Event: "Add"},
+			{From: "read:b", To: "sink:b", Kind: EdgeTaints, Event: "Update"},
+		},
+	}
+}
+
+func TestDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportGraph().WriteDOT(&buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, s := range []string{
+		"digraph kubetorch {",
+		`[label="Pod informer", shape=ellipse]`,
+		`[label="addPod", shape=box]`,
+		`[label="A.queue", shape=cylinder]`,
+		`[label="sync", shape=component]`,
+		`[label="Node spec", shape=hexagon]`,
+		// the events of the edges between the same nodes are merged
+		`[label="read: Add, Update"]`,
+		`[label="taint: Add, Update"]`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("DOT should contain %s, but it is:\n%s", s, dot)
+		}
+	}
+	if n := strings.Count(dot, " -> "); n != 10 {
+		t.Errorf("DOT should have 10 edges, but %d actually", n)
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportGraph().WriteMermaid(&buf, ExportOptions{Collapse: true}); err != nil {
+		t.Fatal(err)
+	}
+	mermaid := buf.String()
+	for _, s := range []string{
+		"flowchart LR",
+		`(["Pod informer"])`,
+		`[/"A"/]`,
+		`[/"B"/]`,
+		`{{"Pod status"}}`,
+		`-->|"register: Add, Update"|`,
+		`-->|"taint: Add, Update"|`,
+	} {
+		if !strings.Contains(mermaid, s) {
+			t.Errorf("Mermaid should contain %s, but it is:\n%s", s, mermaid)
+		}
+	}
+	// the handlers, the fields and the workers are collapsed into their controller
+	for _, s := range []string{"addPod", "queue", "sync"} {
+		if strings.Contains(mermaid, s) {
+			t.Errorf("Mermaid should not contain %s once collapsed, but it is:\n%s", s, mermaid)
+		}
+	}
+	if n := strings.Count(mermaid, " -->"); n != 4 {
+		t.Errorf("Mermaid should have 4 edges once collapsed, but %d actually", n)
+	}
+}
+
+func TestExportFilter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportGraph().WriteDOT(&buf, ExportOptions{Kinds: []string{"Pod"}}); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	if !strings.Contains(dot, "Pod status") || strings.Contains(dot, "Node") || strings.Contains(dot, "B.queue") {
+		t.Errorf("DOT should only show what the Pod informer reaches, but it is:\n%s", dot)
+	}
+	if n := strings.Count(dot, " -> "); n != 4 {
+		t.Errorf("DOT should have 4 edges, but %d actually", n)
+	}
+}
@@ -0,0 +1,509 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"io"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+	"sort"
+	"strings"
+)
+
+// Version is the version of the JSON document. It is bumped on incompatible changes.
+const Version = "kubetorch/v1"
+
+// Kinds of the edges of the graph.
+const (
+	// EdgeRegisters goes from a registration to the handler it registers.
+	EdgeRegisters = "registers"
+	// EdgeWrites goes from a handler to a field it writes.
+	EdgeWrites = "writes"
+	// EdgeReads goes from a field to the point it is read back.
+	EdgeReads = "reads"
+	// EdgeTaints goes from a read point to a sink reached by the data flow.
+	EdgeTaints = "taints"
+	// EdgeGuards goes from a read point to a sink guarded by a branch depending on it.
+	EdgeGuards = "guards"
+)
+
+// Position is a position in the source code.
+type Position struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// Build is the build configuration the package was loaded with, see collector.LoadConfig.
+// The platform is the one resolved, so that the builds of different hosts compare.
+type Build struct {
+	Tags   []string `json:"tags,omitempty"`
+	GOOS   string   `json:"goos"`
+	GOARCH string   `json:"goarch"`
+	Tests  bool     `json:"tests,omitempty"`
+	Env    []string `json:"env,omitempty"`
+}
+
+func (b Build) String() string {
+	s := fmt.Sprintf("%s/%s", b.GOOS, b.GOARCH)
+	if len(b.Tags) != 0 {
+		s += " tags=" + strings.Join(b.Tags, ",")
+	}
+	if b.Tests {
+		s += " tests"
+	}
+	if len(b.Env) != 0 {
+		s += " env=" + strings.Join(b.Env, ",")
+	}
+	return s
+}
+
+// newBuild returns the build of the load config.
+func newBuild(cfg collector.LoadConfig) Build {
+	goos, goarch := cfg.Platform()
+	return Build{Tags: cfg.Tags, GOOS: goos, GOARCH: goarch, Tests: cfg.Tests, Env: cfg.Env}
+}
+
+// Registration is a call registering entry points: a handler registration or a trigger.
+type Registration struct {
+	ID       string   `json:"id"`
+	API      string   `json:"api"`
+	Function string   `json:"function"`
+	Informer string   `json:"informer,omitempty"`
+	Position Position `json:"position"`
+}
+
+// Handler is an entry point for an event or a trigger.
+type Handler struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Function string `json:"function"`
+	// Controller is the type of the receiver of the handler, if any.
+	Controller string   `json:"controller,omitempty"`
+	Event      string   `json:"event"`
+	Position   Position `json:"position"`
+}
+
+// Field is a member written by a handler.
+type Field struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Queue bool   `json:"queue,omitempty"`
+}
+
+// ReadPoint is a value read back from a written field.
+type ReadPoint struct {
+	ID         string   `json:"id"`
+	Function   string   `json:"function"`
+	Controller string   `json:"controller,omitempty"`
+	Position   Position `json:"position"`
+}
+
+// Sink is an API write reached from a read point.
+type Sink struct {
+	ID          string   `json:"id"`
+	Resource    string   `json:"resource"`
+	Part        string   `json:"part"`
+	Subresource string   `json:"subresource,omitempty"`
+	Function    string   `json:"function"`
+	Position    Position `json:"position"`
+}
+
+// Step is a hop of a witness path.
+type Step struct {
+	Value    string    `json:"value"`
+	Function string    `json:"function"`
+	Position *Position `json:"position,omitempty"`
+}
+
+// Edge links two nodes by their IDs. The edges are labeled with the event of the handler.
+type Edge struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Kind    string   `json:"kind"`
+	Event   string   `json:"event"`
+	Sources []string `json:"sources,omitempty"`
+	Fields  []string `json:"fields,omitempty"`
+	Witness []Step   `json:"witness,omitempty"`
+}
+
+// Graph is the informer dependency graph of a package. The IDs of the nodes are built
+// from the names of the functions and types, what the nodes are within the functions
+// and their ordinals among the alike nodes of the functions, e.g.
+// "sink:(*pkg.T).sync#Pod/status#1" for the second write to the status of a Pod in sync.
+// They do not depend on the positions, which are attributes of the nodes, so they are
+// stable across runs and across the versions of the source.
+type Graph struct {
+	Version       string         `json:"version"`
+	Package       string         `json:"package"`
+	Build         Build          `json:"build"`
+	Registrations []Registration `json:"registrations"`
+	Handlers      []Handler      `json:"handlers"`
+	Fields        []Field        `json:"fields"`
+	ReadPoints    []ReadPoint    `json:"readPoints"`
+	Sinks         []Sink         `json:"sinks"`
+	Edges         []Edge         `json:"edges"`
+
+	fset  *token.FileSet
+	nodes map[string]struct{}
+	edges map[string]struct{}
+	// bases are the stable IDs of the nodes by their provisional IDs, before the ordinals
+	bases map[string]string
+}
+
+// NewGraph tracks the entry points of the collector and builds their graph.
+// Only the entry points named handler are tracked, unless handler is empty.
+// With a nil tracker, the graph only has the registrations and the handlers.
+func NewGraph(c *collector.Collector, t *tracker.Tracker, handler string) *Graph {
+	g := &Graph{
+		Version:       Version,
+		Package:       c.GetPattern(),
+		Build:         newBuild(c.GetLoadConfig()),
+		Registrations: []Registration{},
+		Handlers:      []Handler{},
+		Fields:        []Field{},
+		ReadPoints:    []ReadPoint{},
+		Sinks:         []Sink{},
+		Edges:         []Edge{},
+		fset:          c.GetProg().Fset,
+		nodes:         map[string]struct{}{},
+		edges:         map[string]struct{}{},
+		bases:         map[string]string{},
+	}
+	registrations := map[ssa.CallInstruction]map[string]*ssa.Function{}
+	for call, handlers := range c.GetHandlerMap() {
+		registrations[call] = handlers
+	}
+	for instr, triggers := range c.GetTriggerMap() {
+		if registrations[instr] == nil {
+			registrations[instr] = map[string]*ssa.Function{}
+		}
+		for trigger, fn := range triggers {
+			registrations[instr][trigger] = fn
+		}
+	}
+	for instr, entries := range registrations {
+		for event, fn := range entries {
+			if handler != "" && strings.TrimSuffix(fn.Name(), "$bound") != handler {
+				continue
+			}
+			g.addEntry(t, g.addRegistration(instr), fn, event)
+		}
+	}
+	g.stabilize()
+	g.sort()
+	return g
+}
+
+// WriteJSON writes the indented JSON document.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+func (g *Graph) position(pos token.Pos) Position {
+	p := g.fset.Position(pos)
+	return Position{File: p.Filename, Line: p.Line, Column: p.Column}
+}
+
+// nodeID returns the provisional ID of a node of the function at pos, e.g. "sink:(*pkg.T).sync@42:9",
+// and records its stable ID without the ordinal, e.g. "sink:(*pkg.T).sync#Pod/status".
+func (g *Graph) nodeID(kind string, fn *ssa.Function, pos token.Pos, what string) string {
+	p := g.fset.Position(pos)
+	id := fmt.Sprintf("%s:%s@%d:%d", kind, fn.String(), p.Line, p.Column)
+	g.bases[id] = fmt.Sprintf("%s:%s#%s", kind, fn.String(), what)
+	return id
+}
+
+// stabilize replaces the provisional IDs of the registrations, the read points and the sinks
+// with their stable IDs. The alike nodes of a function are numbered by position, the first one
+// has no ordinal.
+func (g *Graph) stabilize() {
+	positions := map[string]Position{}
+	for _, r := range g.Registrations {
+		positions[r.ID] = r.Position
+	}
+	for _, r := range g.ReadPoints {
+		positions[r.ID] = r.Position
+	}
+	for _, s := range g.Sinks {
+		positions[s.ID] = s.Position
+	}
+	groups := map[string][]string{}
+	for id, base := range g.bases {
+		groups[base] = append(groups[base], id)
+	}
+	ids := map[string]string{}
+	for base, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			a, b := positions[group[i]], positions[group[j]]
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			if a.Column != b.Column {
+				return a.Column < b.Column
+			}
+			return a.File < b.File
+		})
+		for i, id := range group {
+			ids[id] = base
+			if i != 0 {
+				ids[id] = fmt.Sprintf("%s#%d", base, i)
+			}
+		}
+	}
+	for i := range g.Registrations {
+		g.Registrations[i].ID = ids[g.Registrations[i].ID]
+	}
+	for i := range g.ReadPoints {
+		g.ReadPoints[i].ID = ids[g.ReadPoints[i].ID]
+	}
+	for i := range g.Sinks {
+		g.Sinks[i].ID = ids[g.Sinks[i].ID]
+	}
+	for i, e := range g.Edges {
+		if id, found := ids[e.From]; found {
+			g.Edges[i].From = id
+		}
+		if id, found := ids[e.To]; found {
+			g.Edges[i].To = id
+		}
+	}
+}
+
+// added tells whether the node was already in the graph, and adds it.
+func (g *Graph) added(id string) bool {
+	_, found := g.nodes[id]
+	g.nodes[id] = struct{}{}
+	return found
+}
+
+func (g *Graph) addRegistration(instr ssa.CallInstruction) string {
+	api, informer := apiName(instr.Common()), ""
+	if call, ok := instr.(*ssa.Call); ok {
+		informer = collector.InformerKind(call)
+	}
+	what := api
+	if informer != "" {
+		what += "/" + informer
+	}
+	id := g.nodeID("registration", instr.Parent(), instr.Pos(), what)
+	if g.added(id) {
+		return id
+	}
+	g.Registrations = append(g.Registrations, Registration{
+		ID:       id,
+		API:      api,
+		Function: instr.Parent().String(),
+		Informer: informer,
+		Position: g.position(instr.Pos()),
+	})
+	return id
+}
+
+func (g *Graph) addEntry(t *tracker.Tracker, registration string, fn *ssa.Function, event string) {
+	id := fmt.Sprintf("handler:%s#%s", fn.String(), event)
+	if !g.added(id) {
+		g.Handlers = append(g.Handlers, Handler{
+			ID:         id,
+			Name:       strings.TrimSuffix(fn.Name(), "$bound"),
+			Function:   fn.String(),
+			Controller: controllerOf(fn),
+			Event:      event,
+			Position:   g.position(fn.Pos()),
+		})
+	}
+	g.addEdge(Edge{From: registration, To: id, Kind: EdgeRegisters, Event: event})
+	if t == nil {
+		return
+	}
+
+	flow := t.FlowFrom(fn)
+	for _, member := range flow.Written {
+		g.addEdge(Edge{From: id, To: g.addField(member), Kind: EdgeWrites, Event: event})
+	}
+	readPoints := map[ssa.Value]string{}
+	for _, read := range flow.Reads {
+		readPoints[read.Value] = g.addReadPoint(read.Value, read.Member)
+		g.addEdge(Edge{From: g.addField(read.Member), To: readPoints[read.Value], Kind: EdgeReads, Event: event})
+	}
+	for _, hit := range flow.Hits {
+		from, found := readPointOf(hit.Witness, readPoints)
+		if !found {
+			continue
+		}
+		g.addEdge(Edge{
+			From:    from,
+			To:      g.addSink(hit.Instr, hit.Sink),
+			Kind:    EdgeTaints,
+			Event:   event,
+			Sources: hit.Sources,
+			Fields:  hit.Fields,
+			Witness: g.steps(hit.Witness),
+		})
+	}
+	for _, hit := range flow.Guarded {
+		from, found := readPointOf(hit.Witness, readPoints)
+		if !found {
+			continue
+		}
+		g.addEdge(Edge{
+			From:    from,
+			To:      g.addSink(hit.Instr, hit.Sink),
+			Kind:    EdgeGuards,
+			Event:   event,
+			Sources: hit.Sources,
+			Witness: g.steps(hit.Witness),
+		})
+	}
+}
+
+// readPointOf returns the ID of the read point a witness path starts from.
+func readPointOf(witness []ssa.Value, readPoints map[ssa.Value]string) (string, bool) {
+	if len(witness) == 0 {
+		return "", false
+	}
+	id, found := readPoints[witness[0]]
+	return id, found
+}
+
+func (g *Graph) addField(fa *ssa.FieldAddr) string {
+	typ := fa.X.Type().Underlying().(*types.Pointer).Elem()
+	name := typ.Underlying().(*types.Struct).Field(fa.Field).Name()
+	// the same field in the vendored and the module builds
+	typeName := collector.TrimVendor(typ.String())
+	id := fmt.Sprintf("field:%s.%s", typeName, name)
+	if g.added(id) {
+		return id
+	}
+	g.Fields = append(g.Fields, Field{ID: id, Type: typeName, Name: name, Queue: tracker.IsQueue(fa.Type())})
+	return id
+}
+
+func (g *Graph) addReadPoint(v ssa.Value, member *ssa.FieldAddr) string {
+	id := g.nodeID("read", v.Parent(), valuePos(v), tracker.FieldName(member.X, member.Field))
+	if !g.added(id) {
+		g.ReadPoints = append(g.ReadPoints, ReadPoint{
+			ID:         id,
+			Function:   v.Parent().String(),
+			Controller: controllerOf(v.Parent()),
+			Position:   g.position(valuePos(v)),
+		})
+	}
+	return id
+}
+
+func (g *Graph) addSink(instr ssa.Instruction, sink tracker.Sink) string {
+	id := g.nodeID("sink", instr.Parent(), instr.Pos(), fmt.Sprintf("%s/%s", sink.Resource, sink.Part))
+	if !g.added(id) {
+		g.Sinks = append(g.Sinks, Sink{
+			ID:          id,
+			Resource:    sink.Resource,
+			Part:        string(sink.Part),
+			Subresource: sink.Subresource,
+			Function:    instr.Parent().String(),
+			Position:    g.position(instr.Pos()),
+		})
+	}
+	return id
+}
+
+func (g *Graph) addEdge(e Edge) {
+	key := strings.Join([]string{e.From, e.To, e.Kind, e.Event}, " ")
+	if _, found := g.edges[key]; found {
+		return
+	}
+	g.edges[key] = struct{}{}
+	g.Edges = append(g.Edges, e)
+}
+
+// steps returns the hops of a witness path.
+func (g *Graph) steps(witness []ssa.Value) []Step {
+	steps := []Step{}
+	for _, v := range witness {
+		step := Step{Value: v.Name()}
+		if v.Parent() != nil {
+			step.Function = v.Parent().String()
+		}
+		if _, ok := v.(ssa.Instruction); ok {
+			step.Value = fmt.Sprintf("%s = %s", v.Name(), v)
+		}
+		if pos := valuePos(v); pos.IsValid() {
+			p := g.position(pos)
+			step.Position = &p
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// sort orders the nodes by ID and the edges by their ends, so that the document is stable.
+func (g *Graph) sort() {
+	sort.Slice(g.Registrations, func(i, j int) bool { return g.Registrations[i].ID < g.Registrations[j].ID })
+	sort.Slice(g.Handlers, func(i, j int) bool { return g.Handlers[i].ID < g.Handlers[j].ID })
+	sort.Slice(g.Fields, func(i, j int) bool { return g.Fields[i].ID < g.Fields[j].ID })
+	sort.Slice(g.ReadPoints, func(i, j int) bool { return g.ReadPoints[i].ID < g.ReadPoints[j].ID })
+	sort.Slice(g.Sinks, func(i, j int) bool { return g.Sinks[i].ID < g.Sinks[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Event < b.Event
+	})
+}
+
+// controllerOf returns the type of the receiver of fn, or of the function fn is declared in.
+// The bound methods, e.g. c.addPod$bound, are the methods themselves.
+func controllerOf(fn *ssa.Function) string {
+	for fn.Parent() != nil {
+		fn = fn.Parent()
+	}
+	method, ok := fn.Object().(*types.Func)
+	if !ok {
+		return ""
+	}
+	recv := method.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return ""
+	}
+	typ := recv.Type()
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	return typ.String()
+}
+
+// valuePos returns the position of v, or the position of the call for the results of a call.
+func valuePos(v ssa.Value) token.Pos {
+	if ex, ok := v.(*ssa.Extract); ok && !ex.Pos().IsValid() {
+		return ex.Tuple.Pos()
+	}
+	return v.Pos()
+}
+
+// apiName returns the name of the function or method called to register the entry points.
+func apiName(common *ssa.CallCommon) string {
+	if common.IsInvoke() {
+		return common.Method.Name()
+	}
+	if callee := common.StaticCallee(); callee != nil {
+		return callee.Name()
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// the workqueue controller of the tracker tests: addPod -> queue -> processNextWorkItem -> syncPod
+const testdataPkg = "kubetorch/ssapasses/tracker/testdata"
+
+var (
+	testOnce      sync.Once
+	testCollector *collector.Collector
+)
+
+func newTestGraph(handler string) *Graph {
+	testOnce.Do(func() {
+		testCollector = collector.NewCollector(testdataPkg)
+		testCollector.CollectEntryPoints()
+	})
+	return NewGraph(testCollector, tracker.NewTracker(testCollector), handler)
+}
+
+func edgesOf(g *Graph, kind string) []Edge {
+	edges := []Edge{}
+	for _, e := range g.Edges {
+		if e.Kind == kind {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+func TestGraph(t *testing.T) {
+	g := newTestGraph("addPod")
+	if g.Version != Version || g.Package != testdataPkg {
+		t.Errorf("header should be %s %s, but %s %s actually", Version, testdataPkg, g.Version, g.Package)
+	}
+	if goos, goarch := (collector.LoadConfig{}).Platform(); g.Build.GOOS != goos || g.Build.GOARCH != goarch {
+		t.Errorf("build should be %s/%s, but %v actually", goos, goarch, g.Build)
+	}
+	if len(g.Registrations) != 1 || g.Registrations[0].API != "AddEventHandler" {
+		t.Fatalf("registrations should be [AddEventHandler], but %v actually", g.Registrations)
+	}
+	if len(g.Handlers) != 1 || g.Handlers[0].Name != "addPod" || g.Handlers[0].Event != "Add" {
+		t.Fatalf("handlers should be [addPod Add], but %v actually", g.Handlers)
+	}
+	if controller := testdataPkg + ".Controller"; g.Handlers[0].Controller != controller {
+		t.Errorf("controller of addPod should be %s, but %s actually", controller, g.Handlers[0].Controller)
+	}
+	if len(g.Fields) != 1 || g.Fields[0].Name != "queue" || !g.Fields[0].Queue {
+		t.Fatalf("fields should be [queue], but %v actually", g.Fields)
+	}
+	if len(g.ReadPoints) != 1 || !strings.HasSuffix(g.ReadPoints[0].Function, "processNextWorkItem") {
+		t.Fatalf("read points should be in processNextWorkItem, but %v actually", g.ReadPoints)
+	}
+	if g.ReadPoints[0].Controller != g.Handlers[0].Controller {
+		t.Errorf("the read point should be in %s, but in %s actually", g.Handlers[0].Controller, g.ReadPoints[0].Controller)
+	}
+	if len(g.Sinks) != 1 || g.Sinks[0].Resource != "Pod" || g.Sinks[0].Part != "status" {
+		t.Fatalf("sinks should be [Pod status], but %v actually", g.Sinks)
+	}
+	if filepath.Base(g.Sinks[0].Position.File) != "workqueue.go" || g.Sinks[0].Position.Line == 0 {
+		t.Errorf("sink should be positioned in workqueue.go, but %v actually", g.Sinks[0].Position)
+	}
+
+	// registration -> handler -> field -> read point -> sink, all labeled with the event
+	chain := []struct{ kind, from, to string }{
+		{EdgeRegisters, g.Registrations[0].ID, g.Handlers[0].ID},
+		{EdgeWrites, g.Handlers[0].ID, g.Fields[0].ID},
+		{EdgeReads, g.Fields[0].ID, g.ReadPoints[0].ID},
+		{EdgeTaints, g.ReadPoints[0].ID, g.Sinks[0].ID},
+	}
+	for _, c := range chain {
+		edges := edgesOf(g, c.kind)
+		if len(edges) != 1 || edges[0].From != c.from || edges[0].To != c.to || edges[0].Event != "Add" {
+			t.Errorf("%s edges should be [%s -> %s], but %v actually", c.kind, c.from, c.to, edges)
+		}
+	}
+	// the IDs do not depend on the positions
+	ids := map[string]string{
+		g.Registrations[0].ID: "registration:" + testdataPkg + ".addAllEventHandlers#AddEventHandler",
+		g.ReadPoints[0].ID:    "read:(*" + testdataPkg + ".Controller).processNextWorkItem#queue",
+		g.Sinks[0].ID:         "sink:(*" + testdataPkg + ".Controller).syncPod#Pod/status",
+	}
+	for actual, expected := range ids {
+		if actual != expected {
+			t.Errorf("ID should be %s, but %s actually", expected, actual)
+		}
+	}
+	taint := edgesOf(g, EdgeTaints)[0]
+	if len(taint.Witness) < 2 || taint.Witness[len(taint.Witness)-1].Position.Line != g.Sinks[0].Position.Line {
+		t.Errorf("witness should end at the sink, but %v actually", taint.Witness)
+	}
+}
+
+func TestStableIDs(t *testing.T) {
+	// two writes to the status of a Pod in sync, moved by an edit above them
+	g := &Graph{
+		Sinks: []Sink{
+			{ID: "sink:sync@12:3", Position: Position{Line: 12, Column: 3}},
+			{ID: "sink:sync@20:3", Position: Position{Line: 20, Column: 3}},
+		},
+		Edges: []Edge{{From: "read:a", To: "sink:sync@20:3", Kind: EdgeTaints}},
+		bases: map[string]string{"sink:sync@12:3": "sink:sync#Pod/status", "sink:sync@20:3": "sink:sync#Pod/status"},
+	}
+	g.stabilize()
+	if g.Sinks[0].ID != "sink:sync#Pod/status" || g.Sinks[1].ID != "sink:sync#Pod/status#1" {
+		t.Errorf("sinks should be numbered by position, but %v actually", g.Sinks)
+	}
+	if g.Edges[0].To != g.Sinks[1].ID || g.Edges[0].From != "read:a" {
+		t.Errorf("edge should go to the second sink, but %v actually", g.Edges[0])
+	}
+}
+
+func TestGraphJSON(t *testing.T) {
+	var first, second bytes.Buffer
+	if err := newTestGraph("").WriteJSON(&first); err != nil {
+		t.Fatal(err)
+	}
+	if err := newTestGraph("").WriteJSON(&second); err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Error("the JSON document should be stable across runs")
+	}
+	decoded := Graph{}
+	if err := json.Unmarshal(first.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	// every edge links nodes of the document
+	ids := map[string]struct{}{}
+	for _, r := range decoded.Registrations {
+		ids[r.ID] = struct{}{}
+	}
+	for _, h := range decoded.Handlers {
+		ids[h.ID] = struct{}{}
+	}
+	for _, f := range decoded.Fields {
+		ids[f.ID] = struct{}{}
+	}
+	for _, r := range decoded.ReadPoints {
+		ids[r.ID] = struct{}{}
+	}
+	for _, s := range decoded.Sinks {
+		ids[s.ID] = struct{}{}
+	}
+	for _, e := range decoded.Edges {
+		_, from := ids[e.From]
+		_, to := ids[e.To]
+		if !from || !to {
+			t.Errorf("edge %s -> %s links unknown nodes", e.From, e.To)
+		}
+	}
+}
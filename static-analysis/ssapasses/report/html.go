@@ -0,0 +1,307 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"html"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	// snippetContext is the number of lines shown around a position.
+	snippetContext = 2
+	// maxHandlerLines bounds the source shown for a handler.
+	maxHandlerLines = 40
+)
+
+type snippetLine struct {
+	No   int
+	Code template.HTML
+	Hit  bool
+}
+
+type snippet struct {
+	File  string
+	Lines []snippetLine
+}
+
+type hopSection struct {
+	ID, Next string
+	Label    string
+	Snippet  *snippet
+}
+
+type chainSection struct {
+	Sink    string
+	Kind    string
+	Sources []string
+	Hops    []hopSection
+}
+
+type readSection struct {
+	Field    string
+	Function string
+	Snippet  *snippet
+}
+
+type handlerSection struct {
+	Title string
+	// Registrations are the registrations of the handler, one per registering edge
+	Registrations []string
+	Source        *snippet
+	Fields        []string
+	Reads         []readSection
+	Chains        []chainSection
+}
+
+type controllerSection struct {
+	Name     string
+	Handlers []handlerSection
+}
+
+type page struct {
+	Version     string
+	Package     string
+	Build       Build
+	Controllers []controllerSection
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>kubetorch report for {{.Package}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+summary { font-size: 1.3em; font-weight: bold; cursor: pointer; }
+.handler { border-left: 3px solid #4078c0; margin: 1em 0; padding-left: 1em; }
+pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; }
+.no { color: #999; display: inline-block; width: 4em; }
+.hit { background: #fff5b1; display: block; }
+.kw { color: #d73a49; font-weight: bold; }
+.str { color: #032f62; }
+.num { color: #005cc5; }
+.com { color: #6a737d; font-style: italic; }
+.hop:target { outline: 2px solid #4078c0; }
+</style>
+</head>
+<body>
+<h1>{{.Package}}</h1>
+<p>kubetorch report {{.Version}}, build {{.Build}}</p>
+{{define "snippet"}}{{if .}}<pre title="{{.File}}">{{range .Lines}}<span{{if .Hit}} class="hit"{{end}}><span class="no">{{.No}}</span>{{.Code}}
+</span>{{end}}</pre>{{end}}{{end}}
+{{range .Controllers}}
+<details open>
+<summary>{{.Name}}</summary>
+{{range .Handlers}}
+<div class="handler">
+<h2>{{.Title}}</h2>
+{{range .Registrations}}<p>registered at {{.}}</p>
+{{end}}
+{{template "snippet" .Source}}
+{{if .Fields}}<h3>Written fields</h3>
+<ul>{{range .Fields}}<li><code>{{.}}</code></li>{{end}}</ul>{{end}}
+{{if .Reads}}<h3>Worker read sites</h3>
+{{range .Reads}}<p><code>{{.Field}}</code> is read in <code>{{.Function}}</code></p>
+{{template "snippet" .Snippet}}{{end}}{{end}}
+{{if .Chains}}<h3>Sinks</h3>
+{{range .Chains}}<h4>{{.Kind}} {{.Sink}}{{if .Sources}} from {{range .Sources}}<code>{{.}}</code> {{end}}{{end}}</h4>
+<ol>{{range .Hops}}<li class="hop" id="{{.ID}}">{{.Label}}{{if .Next}} <a href="#{{.Next}}">next &rarr;</a>{{end}}
+{{template "snippet" .Snippet}}</li>{{end}}</ol>{{end}}{{end}}
+</div>
+{{end}}
+</details>
+{{end}}
+</body>
+</html>
+`))
+
+// highlight returns the line of Go code as HTML, with the keywords, literals and comments marked.
+func highlight(line string) template.HTML {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(line))
+	var s scanner.Scanner
+	// the lines of a snippet are not complete files: the errors are ignored
+	s.Init(file, []byte(line), func(token.Position, string) {}, scanner.ScanComments)
+	b := &strings.Builder{}
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		class := ""
+		switch {
+		case tok.IsKeyword():
+			class = "kw"
+		case tok == token.STRING || tok == token.CHAR:
+			class = "str"
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			class = "num"
+		case tok == token.COMMENT:
+			class = "com"
+		}
+		off := file.Offset(pos)
+		if class == "" || off < last || off+len(lit) > len(line) {
+			continue
+		}
+		b.WriteString(html.EscapeString(line[last:off]))
+		fmt.Fprintf(b, `<span class="%s">%s</span>`, class, html.EscapeString(lit))
+		last = off + len(lit)
+	}
+	b.WriteString(html.EscapeString(line[last:]))
+	return template.HTML(b.String())
+}
+
+// sources reads the files of the snippets once.
+type sources map[string][]string
+
+func (s sources) lines(file string) []string {
+	if lines, found := s[file]; found {
+		return lines
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		s[file] = nil
+		return nil
+	}
+	s[file] = strings.Split(string(data), "\n")
+	return s[file]
+}
+
+// around returns the lines around the position.
+func (s sources) around(p Position) *snippet {
+	return s.snippet(p, p.Line-snippetContext, p.Line+snippetContext)
+}
+
+// function returns the source of the function declared at the position, up to its closing brace.
+func (s sources) function(p Position) *snippet {
+	lines := s.lines(p.File)
+	last := p.Line
+	for last < len(lines) && last < p.Line+maxHandlerLines && !strings.HasPrefix(lines[last-1], "}") {
+		last++
+	}
+	return s.snippet(Position{File: p.File, Line: p.Line}, p.Line, last)
+}
+
+func (s sources) snippet(p Position, first, last int) *snippet {
+	lines := s.lines(p.File)
+	if len(lines) == 0 || p.Line == 0 {
+		return nil
+	}
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	sn := &snippet{File: p.File}
+	for no := first; no <= last; no++ {
+		sn.Lines = append(sn.Lines, snippetLine{No: no, Code: highlight(lines[no-1]), Hit: no == p.Line})
+	}
+	return sn
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// WriteHTML writes a self-contained HTML report: for each registration, the handler source,
+// the fields it writes, the sites where the workers read them back, and the sinks with their
+// witness paths. The controllers are collapsible sections.
+func (g *Graph) WriteHTML(w io.Writer) error {
+	src := sources{}
+	nodes := map[string]interface{}{}
+	for _, r := range g.Registrations {
+		nodes[r.ID] = r
+	}
+	for _, f := range g.Fields {
+		nodes[f.ID] = f
+	}
+	for _, r := range g.ReadPoints {
+		nodes[r.ID] = r
+	}
+	for _, s := range g.Sinks {
+		nodes[s.ID] = s
+	}
+	from := map[string][]Edge{}
+	for _, e := range g.Edges {
+		from[e.From] = append(from[e.From], e)
+	}
+
+	byController := map[string]*controllerSection{}
+	chains := 0
+	for _, h := range g.Handlers {
+		name := h.Controller
+		if name == "" {
+			name = g.Package
+		}
+		if byController[name] == nil {
+			byController[name] = &controllerSection{Name: name}
+		}
+		section := handlerSection{
+			Title:  fmt.Sprintf("%s handler %s", h.Event, h.Name),
+			Source: src.function(h.Position),
+		}
+		for _, e := range g.Edges {
+			if r, ok := nodes[e.From].(Registration); ok && e.To == h.ID {
+				registration := r.Position.String()
+				if r.Informer != "" {
+					registration += fmt.Sprintf(" (%s informer)", r.Informer)
+				}
+				section.Registrations = append(section.Registrations, registration)
+			}
+		}
+		for _, write := range from[h.ID] {
+			field := nodes[write.To].(Field)
+			section.Fields = append(section.Fields, field.Type+"."+field.Name)
+			for _, read := range from[field.ID] {
+				if read.Kind != EdgeReads || read.Event != h.Event {
+					continue
+				}
+				rp := nodes[read.To].(ReadPoint)
+				section.Reads = append(section.Reads, readSection{Field: field.Name, Function: rp.Function, Snippet: src.around(rp.Position)})
+				for _, taint := range from[rp.ID] {
+					if taint.Event != h.Event {
+						continue
+					}
+					sink := nodes[taint.To].(Sink)
+					chain := chainSection{Sink: sinkName(sink), Kind: taint.Kind, Sources: taint.Sources}
+					hops := []hopSection{}
+					for _, step := range taint.Witness {
+						if step.Position != nil {
+							hops = append(hops, hopSection{Label: step.Value + " in " + shortName(step.Function), Snippet: src.around(*step.Position)})
+						}
+					}
+					hops = append(hops, hopSection{Label: sinkName(sink) + " is changed in " + shortName(sink.Function), Snippet: src.around(sink.Position)})
+					for i := range hops {
+						hops[i].ID = fmt.Sprintf("chain%d-hop%d", chains, i)
+						if i+1 < len(hops) {
+							hops[i].Next = fmt.Sprintf("chain%d-hop%d", chains, i+1)
+						}
+					}
+					chain.Hops = hops
+					chains++
+					section.Chains = append(section.Chains, chain)
+				}
+			}
+		}
+		byController[name].Handlers = append(byController[name].Handlers, section)
+	}
+
+	p := page{Version: g.Version, Package: g.Package, Build: g.Build}
+	for _, c := range byController {
+		p.Controllers = append(p.Controllers, *c)
+	}
+	sort.Slice(p.Controllers, func(i, j int) bool { return p.Controllers[i].Name < p.Controllers[j].Name })
+	return htmlTemplate.Execute(w, p)
+}
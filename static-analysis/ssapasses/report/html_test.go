@@ -0,0 +1,65 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	actual := string(highlight(`	if s == "<a>" { return 1 } // done`))
+	expected := `	<span class="kw">if</span> s == <span class="str">&#34;&lt;a&gt;&#34;</span> { ` +
+		`<span class="kw">return</span> <span class="num">1</span> } <span class="com">// done</span>`
+	if actual != expected {
+		t.Errorf("highlighted line should be\n%s\nbut\n%s\nactually", expected, actual)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestGraph("addPod").WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, s := range []string{
+		// a collapsible section per controller
+		"<details open>\n<summary>" + testdataPkg + ".Controller</summary>",
+		"<h2>Add handler addPod</h2>",
+		// the source of the handler
+		`<span class="kw">func</span> (c *Controller) addPod(obj <span class="kw">interface</span>{}) {`,
+		"<code>" + testdataPkg + ".Controller.queue</code>",
+		"<code>queue</code> is read in <code>(*" + testdataPkg + ".Controller).processNextWorkItem</code>",
+		"<h4>taints Pod status from <code>obj</code> </h4>",
+		// the hops of the witness path are linked
+		`id="chain0-hop0"`,
+		`<a href="#chain0-hop1">next &rarr;</a>`,
+		"Pod status is changed in syncPod",
+	} {
+		if !strings.Contains(page, s) {
+			t.Errorf("report should contain %s, but it is:\n%s", s, page)
+		}
+	}
+}
+
+func TestHTMLRegistrations(t *testing.T) {
+	g := exportGraph()
+	// addPod is registered on two informers
+	g.Registrations = append(g.Registrations, Registration{ID: "registration:pods2", API: "AddEventHandler", Informer: "Node"})
+	g.Edges = append(g.Edges, Edge{From: "registration:pods2", To: "handler:addPod#Add", Kind: EdgeRegisters, Event: "Add"})
+	var buf bytes.Buffer
+	if err := g.WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	section := buf.String()
+	section = section[strings.Index(section, "<h2>Add handler addPod</h2>"):]
+	section = section[:strings.Index(section, "</div>")]
+	for _, s := range []string{"(Pod informer)</p>", "(Node informer)</p>"} {
+		if !strings.Contains(section, s) {
+			t.Errorf("the section of addPod should contain %s, but it is:\n%s", s, section)
+		}
+	}
+}
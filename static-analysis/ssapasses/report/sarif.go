@@ -0,0 +1,321 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kubetorch/ssapasses/checker"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	// srcRoot is the base of the URIs of the files under the root of the sources.
+	srcRoot = "SRCROOT"
+)
+
+// Rules of the side-effect chains of the graph. The findings of the checkers are
+// reported under the names of the checkers.
+const (
+	RuleSideEffect        = "sideeffect"
+	RuleGuardedSideEffect = "guardedsideeffect"
+)
+
+// ruleDescriptions describe the rules, see the checker package and README.md.
+var ruleDescriptions = map[string]string{
+	RuleSideEffect:        "A handler changes a resource through the state it writes and a worker reads back.",
+	RuleGuardedSideEffect: "A handler decides whether a resource is changed through the state it writes.",
+	"deepcopy":            "An object shared with the informer cache is mutated without DeepCopy.",
+	"tombstone":           "A Delete handler does not handle cache.DeletedFinalStateUnknown.",
+	"blocking":            "A handler may block the notifications of the shared informer.",
+	"lockset":             "A field is shared by handlers and workers without a common lock.",
+	"idempotency":         "An Update handler writes even when a resync delivers old == new.",
+	"lostupdate":          "An object read from the cache is written back without conflict handling.",
+	"conflict":            "Two components write the same part of the same resource.",
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifact `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult            `json:"results"`
+	Properties         sarifRunProperties       `json:"properties"`
+}
+
+// sarifRunProperties is the property bag of the run: the build the package was loaded with.
+type sarifRunProperties struct {
+	Build Build `json:"build"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifArtifact struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifThreadFlowLocation struct {
+	Location sarifLocation `json:"location"`
+}
+
+type sarifThreadFlow struct {
+	Locations []sarifThreadFlowLocation `json:"locations"`
+}
+
+type sarifCodeFlow struct {
+	ThreadFlows []sarifThreadFlow `json:"threadFlows"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+	CodeFlows        []sarifCodeFlow `json:"codeFlows,omitempty"`
+}
+
+// sarifWriter builds the results of a run, with the files relative to root.
+type sarifWriter struct {
+	root    string
+	rules   []sarifRule
+	indexOf map[string]int
+	results []sarifResult
+}
+
+func (s *sarifWriter) location(p Position, note string) (sarifLocation, bool) {
+	if p.File == "" || p.Line == 0 {
+		return sarifLocation{}, false
+	}
+	artifact := sarifArtifact{URI: filepath.ToSlash(p.File)}
+	if rel, err := filepath.Rel(s.root, p.File); s.root != "" && err == nil && !strings.HasPrefix(rel, "..") {
+		artifact = sarifArtifact{URI: filepath.ToSlash(rel), URIBaseID: srcRoot}
+	} else if filepath.IsAbs(p.File) {
+		artifact.URI = "file://" + artifact.URI
+	}
+	loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: artifact,
+		Region:           sarifRegion{StartLine: p.Line, StartColumn: p.Column},
+	}}
+	if note != "" {
+		loc.Message = &sarifMessage{Text: note}
+	}
+	return loc, true
+}
+
+// hop is a location of a result: its position and what happens there.
+type hop struct {
+	pos  Position
+	note string
+}
+
+// add adds a result at the sink with the registration of the handler and the flow from it.
+func (s *sarifWriter) add(rule, level, message string, sink Position, registration *hop, flow []hop) {
+	index, found := s.indexOf[rule]
+	if !found {
+		index = len(s.rules)
+		s.indexOf[rule] = index
+		s.rules = append(s.rules, sarifRule{ID: rule, ShortDescription: sarifMessage{Text: ruleDescriptions[rule]}})
+	}
+	result := sarifResult{RuleID: rule, RuleIndex: index, Level: level, Message: sarifMessage{Text: message}, Locations: []sarifLocation{}}
+	if loc, ok := s.location(sink, ""); ok {
+		result.Locations = append(result.Locations, loc)
+	}
+	if registration != nil {
+		if loc, ok := s.location(registration.pos, registration.note); ok {
+			loc.ID = 1
+			result.RelatedLocations = append(result.RelatedLocations, loc)
+		}
+	}
+	threadFlow := sarifThreadFlow{Locations: []sarifThreadFlowLocation{}}
+	for _, h := range flow {
+		if loc, ok := s.location(h.pos, h.note); ok {
+			threadFlow.Locations = append(threadFlow.Locations, sarifThreadFlowLocation{Location: loc})
+		}
+	}
+	if len(threadFlow.Locations) != 0 {
+		result.CodeFlows = []sarifCodeFlow{{ThreadFlows: []sarifThreadFlow{threadFlow}}}
+	}
+	s.results = append(s.results, result)
+}
+
+// chains adds a result for each side-effect chain of the graph: a handler writing a field read
+// back by a worker reaching a sink. The code flow goes from the registration to the sink
+// through the witness path.
+func (g *Graph) chains(s *sarifWriter) {
+	byID := map[string]interface{}{}
+	for _, r := range g.Registrations {
+		byID[r.ID] = r
+	}
+	for _, h := range g.Handlers {
+		byID[h.ID] = h
+	}
+	for _, f := range g.Fields {
+		byID[f.ID] = f
+	}
+	for _, sink := range g.Sinks {
+		byID[sink.ID] = sink
+	}
+	into := map[string][]Edge{}
+	for _, e := range g.Edges {
+		into[e.To] = append(into[e.To], e)
+	}
+	type chain struct{ handler, sink, kind string }
+	reported := map[chain]struct{}{}
+	for _, taint := range g.Edges {
+		if taint.Kind != EdgeTaints && taint.Kind != EdgeGuards {
+			continue
+		}
+		sink := byID[taint.To].(Sink)
+		for _, read := range into[taint.From] {
+			if read.Kind != EdgeReads || read.Event != taint.Event {
+				continue
+			}
+			field := byID[read.From].(Field)
+			for _, write := range into[read.From] {
+				if write.Kind != EdgeWrites || write.Event != taint.Event {
+					continue
+				}
+				handler := byID[write.From].(Handler)
+				key := chain{handler.ID, sink.ID, taint.Kind}
+				if _, found := reported[key]; found {
+					continue
+				}
+				reported[key] = struct{}{}
+
+				rule, verb := RuleSideEffect, "changes"
+				if taint.Kind == EdgeGuards {
+					rule, verb = RuleGuardedSideEffect, "decides whether to change"
+				}
+				message := fmt.Sprintf("%s handler %s %s %s through %s.%s",
+					handler.Event, handler.Name, verb, sinkName(sink), shortName(field.Type), field.Name)
+				flow := []hop{}
+				var registration *hop
+				for _, reg := range into[handler.ID] {
+					if r, ok := byID[reg.From].(Registration); ok && reg.Kind == EdgeRegisters {
+						registration = &hop{r.Position, fmt.Sprintf("the %s handler %s is registered here", handler.Event, handler.Name)}
+						flow = append(flow, *registration)
+						break
+					}
+				}
+				flow = append(flow, hop{handler.Position, fmt.Sprintf("%s writes %s", handler.Name, field.Name)})
+				for _, step := range taint.Witness {
+					if step.Position != nil {
+						flow = append(flow, hop{*step.Position, step.Value})
+					}
+				}
+				flow = append(flow, hop{sink.Position, fmt.Sprintf("%s is changed here", sinkName(sink))})
+				s.add(rule, "note", message, sink.Position, registration, flow)
+			}
+		}
+	}
+}
+
+func sinkName(s Sink) string {
+	if s.Subresource != "" {
+		return s.Resource + "/" + s.Subresource
+	}
+	return s.Resource + " " + s.Part
+}
+
+// WriteSARIF writes a SARIF 2.1.0 log of the side-effect chains of the graph and of the
+// findings of the checkers. The files under root are relative to the SRCROOT base.
+func (g *Graph) WriteSARIF(w io.Writer, findings []checker.Finding, root string) error {
+	return WriteSARIF(w, []*Graph{g}, findings, root)
+}
+
+// WriteSARIF writes a SARIF 2.1.0 log of the side-effect chains of the graphs, e.g. of the
+// packages checked together, and of the findings of the checkers, in one run. The graphs
+// are built from the same program with the same build. The files under root are relative
+// to the SRCROOT base.
+func WriteSARIF(w io.Writer, graphs []*Graph, findings []checker.Finding, root string) error {
+	if len(graphs) == 0 {
+		return errors.New("no graph to write")
+	}
+	s := &sarifWriter{root: root, indexOf: map[string]int{}}
+	for _, g := range graphs {
+		g.chains(s)
+	}
+	g := graphs[0]
+	for _, f := range findings {
+		var registration *hop
+		if f.Registration.IsValid() {
+			registration = &hop{g.position(f.Registration), "the handler is registered here"}
+		}
+		flow := []hop{}
+		for _, r := range f.Related {
+			flow = append(flow, hop{g.position(r.Pos), r.Note})
+		}
+		flow = append(flow, hop{g.position(f.Pos), f.Message})
+		s.add(f.Checker, "warning", f.Message, g.position(f.Pos), registration, flow)
+	}
+	sort.SliceStable(s.results, func(i, j int) bool { return s.results[i].RuleID < s.results[j].RuleID })
+
+	run := sarifRun{
+		Tool:       sarifTool{Driver: sarifDriver{Name: "kubetorch", Rules: s.rules}},
+		Results:    s.results,
+		Properties: sarifRunProperties{Build: g.Build},
+	}
+	if root != "" {
+		uri := "file://" + filepath.ToSlash(root)
+		if !strings.HasSuffix(uri, "/") {
+			uri += "/"
+		}
+		run.OriginalURIBaseIDs = map[string]sarifArtifact{srcRoot: {URI: uri}}
+	}
+	if run.Results == nil {
+		run.Results = []sarifResult{}
+	}
+	if run.Tool.Driver.Rules == nil {
+		run.Tool.Driver.Rules = []sarifRule{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}})
+}
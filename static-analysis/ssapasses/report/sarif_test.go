@@ -0,0 +1,109 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"kubetorch/ssapasses/checker"
+	"kubetorch/ssapasses/collector"
+	"kubetorch/ssapasses/tracker"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func decodeSARIF(t *testing.T, buf *bytes.Buffer) sarifRun {
+	log := sarifLog{}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("log should have version 2.1.0 and 1 run, but %s and %d actually", log.Version, len(log.Runs))
+	}
+	return log.Runs[0]
+}
+
+func TestSARIFChains(t *testing.T) {
+	g := newTestGraph("addPod")
+	root := filepath.Dir(g.Sinks[0].Position.File)
+	var buf bytes.Buffer
+	if err := g.WriteSARIF(&buf, nil, root); err != nil {
+		t.Fatal(err)
+	}
+	run := decodeSARIF(t, &buf)
+	if len(run.Results) != 1 {
+		t.Fatalf("results len should be 1, but %d actually", len(run.Results))
+	}
+	result := run.Results[0]
+	if result.RuleID != RuleSideEffect || run.Tool.Driver.Rules[result.RuleIndex].ID != RuleSideEffect {
+		t.Errorf("rule should be %s, but %s actually", RuleSideEffect, result.RuleID)
+	}
+	if msg := "Add handler addPod changes Pod status through Controller.queue"; result.Message.Text != msg {
+		t.Errorf("message should be %q, but %q actually", msg, result.Message.Text)
+	}
+	// the sink is the location, relative to the root
+	sink := result.Locations[0].PhysicalLocation
+	if sink.ArtifactLocation.URI != "workqueue.go" || sink.ArtifactLocation.URIBaseID != srcRoot ||
+		sink.Region.StartLine != g.Sinks[0].Position.Line {
+		t.Errorf("location should be the sink in workqueue.go, but %v actually", sink)
+	}
+	if len(result.RelatedLocations) != 1 || result.RelatedLocations[0].PhysicalLocation.ArtifactLocation.URI != "testdata.go" {
+		t.Errorf("related location should be the registration in testdata.go, but %v actually", result.RelatedLocations)
+	}
+	// registration -> handler -> witness -> sink
+	flow := result.CodeFlows[0].ThreadFlows[0].Locations
+	first, last := flow[0].Location, flow[len(flow)-1].Location
+	if first.PhysicalLocation != result.RelatedLocations[0].PhysicalLocation || last.PhysicalLocation != sink {
+		t.Errorf("code flow should go from the registration to the sink, but %v actually", flow)
+	}
+	if len(flow) < 4 {
+		t.Errorf("code flow should go through the witness path, but %v actually", flow)
+	}
+}
+
+func TestSARIFFindings(t *testing.T) {
+	c := collector.NewCollector("kubetorch/ssapasses/checker/testdata")
+	c.CollectEntryPoints()
+	tr := tracker.NewTracker(c)
+	findings, err := checker.NewChecker(c, tr).Check("tombstone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewGraph(c, tr, "").WriteSARIF(&buf, findings, ""); err != nil {
+		t.Fatal(err)
+	}
+	run := decodeSARIF(t, &buf)
+	if len(run.Results) != len(findings) || len(findings) == 0 {
+		t.Fatalf("results len should be %d, but %d actually", len(findings), len(run.Results))
+	}
+	for _, result := range run.Results {
+		if result.RuleID != "tombstone" || result.Level != "warning" {
+			t.Errorf("result should be a tombstone warning, but %s %s actually", result.RuleID, result.Level)
+		}
+		uri := result.Locations[0].PhysicalLocation.ArtifactLocation.URI
+		if !strings.HasPrefix(uri, "file://") || !strings.HasSuffix(uri, "tombstone.go") {
+			t.Errorf("location should be an absolute URI to tombstone.go, but %s actually", uri)
+		}
+		if len(result.RelatedLocations) != 1 || len(result.CodeFlows) != 1 {
+			t.Errorf("result should have the registration and a code flow, but %v actually", result)
+		}
+	}
+}
+
+func TestSARIFGraphs(t *testing.T) {
+	var all, one bytes.Buffer
+	if err := newTestGraph("").WriteSARIF(&all, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	// the chains of every graph, e.g. of every package checked
+	if err := WriteSARIF(&one, []*Graph{newTestGraph("addPod"), newTestGraph("")}, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := len(decodeSARIF(t, &all).Results)+1, len(decodeSARIF(t, &one).Results); actual != expected {
+		t.Errorf("results len should be %d, but %d actually", expected, actual)
+	}
+}
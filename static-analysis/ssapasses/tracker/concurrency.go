@@ -0,0 +1,163 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package tracker
+
+import (
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/collector"
+	"strings"
+)
+
+const retryPkg = "k8s.io/client-go/util/retry"
+
+// PayloadFields returns the paths of the fields set by the body of a Patch call,
+// e.g. "status.conditions", when the body is built in the same function.
+func PayloadFields(call *ssa.Call) []string {
+	common := call.Common()
+	if calleeName(common) != "Patch" {
+		return nil
+	}
+	body := payloadArg(callArgs(common), true)
+	if body == nil {
+		return nil
+	}
+	all, _, _ := payloadPaths(body, nil)
+	return all
+}
+
+// rootOf returns the value v is converted from, e.g. the pointer put into an interface.
+func rootOf(v ssa.Value) ssa.Value {
+	for {
+		switch v.(type) {
+		case *ssa.MakeInterface:
+			v = v.(*ssa.MakeInterface).X
+		case *ssa.ChangeType:
+			v = v.(*ssa.ChangeType).X
+		default:
+			return v
+		}
+	}
+}
+
+// HasPrecondition tells whether the API call is conditioned on the resourceVersion of the
+// object: an Update of an existing object carries its resourceVersion, a Patch body may set
+// one of the preconditions, e.g. metadata.resourceVersion or ObjectMeta.UID, and DeleteOptions
+// may have Preconditions.
+func HasPrecondition(call *ssa.Call) bool {
+	common := call.Common()
+	switch calleeName(common) {
+	case "Update", "UpdateStatus":
+		// a new object has no resourceVersion
+		for _, arg := range callArgs(common) {
+			if IsAPIObject(arg.Type()) {
+				_, fresh := rootOf(arg).(*ssa.Alloc)
+				return !fresh
+			}
+		}
+	case "Patch":
+		for _, path := range PayloadFields(call) {
+			if _, found := preconditions[strings.ToLower(path)]; found {
+				return true
+			}
+		}
+	case "Delete", "DeleteCollection":
+		for _, arg := range callArgs(common) {
+			load, ok := arg.(*ssa.UnOp)
+			if !ok || !strings.HasSuffix(DerefType(arg.Type()).String(), "DeleteOptions") {
+				continue
+			}
+			al, ok := load.X.(*ssa.Alloc)
+			if !ok {
+				continue
+			}
+			for _, ref := range *al.Referrers() {
+				if fa, ok := ref.(*ssa.FieldAddr); ok && FieldName(al, fa.Field) == "Preconditions" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// retryDepth bounds the callers walked up from a write to the closure passed to retry.RetryOnConflict.
+const retryDepth = 4
+
+// RetriesOnConflict tells whether instr is executed by a closure passed to retry.RetryOnConflict,
+// directly or through the functions of the package it calls.
+func (t *Tracker) RetriesOnConflict(instr ssa.Instruction) bool {
+	start := instr.Parent()
+	callers := t.callersIn(start.Pkg)
+	visited := map[*ssa.Function]struct{}{}
+	level := []*ssa.Function{start}
+	for depth := 0; depth <= retryDepth && len(level) != 0; depth++ {
+		next := []*ssa.Function{}
+		for _, fn := range level {
+			if _, found := visited[fn]; found {
+				continue
+			}
+			visited[fn] = struct{}{}
+			if isRetried(fn) {
+				return true
+			}
+			// the closures are executed by the function they are declared in, or passed to
+			if fn.Parent() != nil {
+				next = append(next, fn.Parent())
+			}
+			next = append(next, callers[fn]...)
+		}
+		level = next
+	}
+	return false
+}
+
+// callersIn returns the callers of the functions called in pkg, computed once per package.
+func (t *Tracker) callersIn(pkg *ssa.Package) map[*ssa.Function][]*ssa.Function {
+	if pkg == nil {
+		return nil
+	}
+	if callers, found := t.callers[pkg]; found {
+		return callers
+	}
+	callers := map[*ssa.Function][]*ssa.Function{}
+	for _, fn := range collector.PackageFunctions(pkg.Prog, pkg) {
+		for _, block := range fn.Blocks {
+			for _, in := range block.Instrs {
+				if call, ok := in.(ssa.CallInstruction); ok && call.Common().StaticCallee() != nil {
+					callee := call.Common().StaticCallee()
+					callers[callee] = append(callers[callee], fn)
+				}
+			}
+		}
+	}
+	t.callers[pkg] = callers
+	return callers
+}
+
+// isRetried tells whether fn is a closure passed to retry.RetryOnConflict.
+func isRetried(fn *ssa.Function) bool {
+	if fn.Parent() == nil {
+		return false
+	}
+	for _, block := range fn.Parent().Blocks {
+		for _, in := range block.Instrs {
+			mc, ok := in.(*ssa.MakeClosure)
+			if !ok || mc.Fn != fn {
+				continue
+			}
+			for _, ref := range *mc.Referrers() {
+				call, ok := ref.(*ssa.Call)
+				if !ok || call.Common().StaticCallee() == nil {
+					continue
+				}
+				callee := call.Common().StaticCallee()
+				if callee.Name() == "RetryOnConflict" && callee.Pkg != nil && collector.MatchPath(callee.Pkg.Pkg.Path(), retryPkg) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
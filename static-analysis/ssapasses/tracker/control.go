@@ -0,0 +1,293 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package tracker
+
+import (
+	"golang.org/x/tools/go/ssa"
+)
+
+// GuardedHit is a sink whose execution is control dependent on a tainted branch
+// condition (implicit flow). It is reported apart from the data flow sinks.
+type GuardedHit struct {
+	Instr ssa.Instruction
+	Sink  Sink
+	// Guard is the branch deciding whether the sink is executed.
+	Guard *ssa.If
+	// Sources lists the access paths of the informer object the condition depends on.
+	Sources []string
+	// Witness is a chain of tainted values from a read point to the condition of the guard.
+	Witness []ssa.Value
+}
+
+// postDominators returns the immediate post-dominator of each block of fn, with the
+// iterative algorithm of Cooper, Harvey and Kennedy on the reverse control flow graph.
+// Blocks whose immediate post-dominator is the exit of fn are mapped to nil.
+func postDominators(fn *ssa.Function) map[*ssa.BasicBlock]*ssa.BasicBlock {
+	n := len(fn.Blocks)
+	exit := n
+	succs := make([][]int, n+1)
+	preds := make([][]int, n+1)
+	edge := func(from, to int) {
+		succs[from] = append(succs[from], to)
+		preds[to] = append(preds[to], from)
+	}
+	for _, block := range fn.Blocks {
+		if len(block.Succs) == 0 {
+			edge(block.Index, exit)
+		}
+		for _, succ := range block.Succs {
+			edge(block.Index, succ.Index)
+		}
+	}
+
+	// the blocks never reaching the exit, e.g. in an infinite loop, get an edge to it
+	reached := make([]bool, n+1)
+	var reach func(i int)
+	reach = func(i int) {
+		reached[i] = true
+		for _, p := range preds[i] {
+			if !reached[p] {
+				reach(p)
+			}
+		}
+	}
+	reach(exit)
+	for i := n - 1; i >= 0; i-- {
+		if !reached[i] {
+			edge(i, exit)
+			reach(i)
+		}
+	}
+
+	// the postorder of the reverse graph from the exit
+	order := make([]int, n+1)
+	postorder := []int{}
+	visited := make([]bool, n+1)
+	var visit func(i int)
+	visit = func(i int) {
+		visited[i] = true
+		for _, p := range preds[i] {
+			if !visited[p] {
+				visit(p)
+			}
+		}
+		order[i] = len(postorder)
+		postorder = append(postorder, i)
+	}
+	visit(exit)
+
+	idom := make([]int, n+1)
+	for i := range idom {
+		idom[i] = -1
+	}
+	idom[exit] = exit
+	intersect := func(a, b int) int {
+		for a != b {
+			for order[a] < order[b] {
+				a = idom[a]
+			}
+			for order[b] < order[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		// in reverse postorder, the exit excluded
+		for k := len(postorder) - 2; k >= 0; k-- {
+			i := postorder[k]
+			dom := -1
+			for _, s := range succs[i] {
+				if idom[s] == -1 {
+					continue
+				}
+				if dom == -1 {
+					dom = s
+				} else {
+					dom = intersect(s, dom)
+				}
+			}
+			if dom != idom[i] {
+				idom[i] = dom
+				changed = true
+			}
+		}
+	}
+
+	ipdom := map[*ssa.BasicBlock]*ssa.BasicBlock{}
+	for i := 0; i < n; i++ {
+		if idom[i] != exit && idom[i] != -1 {
+			ipdom[fn.Blocks[i]] = fn.Blocks[idom[i]]
+		}
+	}
+	return ipdom
+}
+
+// controlDeps maps each block of fn to the If instructions deciding whether it is executed.
+func controlDeps(fn *ssa.Function) map[*ssa.BasicBlock][]*ssa.If {
+	deps := map[*ssa.BasicBlock][]*ssa.If{}
+	ipdom := postDominators(fn)
+	for _, block := range fn.Blocks {
+		if len(block.Instrs) == 0 {
+			continue
+		}
+		cond, ok := block.Instrs[len(block.Instrs)-1].(*ssa.If)
+		if !ok {
+			continue
+		}
+		// every block on the post-dominator tree path from a successor up to
+		// (but excluding) the post-dominator of the branch depends on it
+		for _, succ := range block.Succs {
+			seen := map[*ssa.BasicBlock]struct{}{}
+			for runner := succ; runner != nil && runner != ipdom[block]; runner = ipdom[runner] {
+				if _, found := seen[runner]; found {
+					break
+				}
+				seen[runner] = struct{}{}
+				deps[runner] = append(deps[runner], cond)
+			}
+		}
+	}
+	return deps
+}
+
+// taintedFunctions returns the functions holding the tainted values.
+func taintedFunctions(taintedVars map[ssa.Value]*taint) map[*ssa.Function]struct{} {
+	funs := map[*ssa.Function]struct{}{}
+	for v := range taintedVars {
+		switch v.(type) {
+		case ssa.Instruction:
+			funs[v.(ssa.Instruction).Parent()] = struct{}{}
+		case *ssa.Parameter:
+			funs[v.Parent()] = struct{}{}
+		case *ssa.FreeVar:
+			funs[v.Parent()] = struct{}{}
+		}
+	}
+	return funs
+}
+
+// trackControlDependence finds the sinks guarded by tainted branch conditions:
+// the sinks executed only on one side of the branch, and the sinks reached by
+// a Phi whose incoming value is selected by the branch.
+func (t *Tracker) trackControlDependence(taintedVars map[ssa.Value]*taint) []GuardedHit {
+	guarded := []GuardedHit{}
+	for fun := range taintedFunctions(taintedVars) {
+		deps := controlDeps(fun)
+		tainted := func(conds []*ssa.If) *ssa.If {
+			for _, cond := range conds {
+				if _, found := taintedVars[cond.Cond]; found {
+					return cond
+				}
+			}
+			return nil
+		}
+		for _, block := range fun.Blocks {
+			if guard := tainted(deps[block]); guard != nil {
+				for _, instr := range block.Instrs {
+					for _, hit := range t.sinksWithin(instr, t.guardDepth(), map[*ssa.Function]struct{}{}) {
+						guarded = append(guarded, GuardedHit{Instr: hit.Instr, Sink: hit.Sink, Guard: guard})
+					}
+				}
+			}
+			for _, instr := range block.Instrs {
+				phi, ok := instr.(*ssa.Phi)
+				if !ok {
+					continue
+				}
+				if _, found := taintedVars[phi]; found {
+					continue
+				}
+				guard := t.selectingBranch(phi, deps, tainted)
+				if guard == nil {
+					continue
+				}
+				// a fresh run, so that the data flow sinks are not mixed with these ones
+				phiVars := map[ssa.Value]*taint{phi: {}}
+				hits := t.resolvePayloads(t.trackReadPointWithinMethod(fun, []ssa.Value{phi}, phiVars, 0), phiVars)
+				for _, hit := range hits {
+					guarded = append(guarded, GuardedHit{Instr: hit.Instr, Sink: hit.Sink, Guard: guard})
+				}
+			}
+		}
+	}
+	for i := range guarded {
+		guarded[i].Sources = sourcesOf(guarded[i].Guard.Cond, taintedVars)
+		guarded[i].Witness = witnessOf(guarded[i].Guard.Cond, taintedVars)
+	}
+	return guarded
+}
+
+// selectingBranch returns the tainted branch deciding which edge of the Phi is taken, if any.
+func (t *Tracker) selectingBranch(phi *ssa.Phi, deps map[*ssa.BasicBlock][]*ssa.If, tainted func([]*ssa.If) *ssa.If) *ssa.If {
+	same := true
+	for _, edge := range phi.Edges {
+		same = same && edge == phi.Edges[0]
+	}
+	if same {
+		return nil
+	}
+	for _, pred := range phi.Block().Preds {
+		if len(pred.Instrs) != 0 {
+			if cond, ok := pred.Instrs[len(pred.Instrs)-1].(*ssa.If); ok {
+				if guard := tainted([]*ssa.If{cond}); guard != nil {
+					return guard
+				}
+			}
+		}
+		if guard := tainted(deps[pred]); guard != nil {
+			return guard
+		}
+	}
+	return nil
+}
+
+// guardDepth returns how deep the callees of a guarded call are searched for sinks,
+// negative for no bound, see Budgets.
+func (t *Tracker) guardDepth() int {
+	if t.budgets.Guards == 0 {
+		return -1
+	}
+	return t.budgets.Guards
+}
+
+// sinksWithin returns the sinks executed by instr, looking into the callees up to depth.
+func (t *Tracker) sinksWithin(instr ssa.Instruction, depth int, visited map[*ssa.Function]struct{}) []SinkHit {
+	if al, ok := instr.(*ssa.Alloc); ok {
+		if sink, found := t.payloadSink(al); found {
+			return []SinkHit{{Instr: al, Sink: sink}}
+		}
+		return nil
+	}
+	callInstr, ok := instr.(ssa.CallInstruction)
+	if !ok {
+		return nil
+	}
+	if sink, found := t.CallSink(callInstr.Common()); found {
+		return []SinkHit{{Instr: instr, Sink: sink}}
+	}
+	var callee *ssa.Function
+	switch callInstr.Common().Value.(type) {
+	case *ssa.Function:
+		callee = callInstr.Common().Value.(*ssa.Function)
+	case *ssa.MakeClosure:
+		callee, _ = callInstr.Common().Value.(*ssa.MakeClosure).Fn.(*ssa.Function)
+	}
+	if callee == nil || depth == 0 {
+		return nil
+	}
+	if _, found := visited[callee]; found {
+		return nil
+	}
+	visited[callee] = struct{}{}
+	hits := []SinkHit{}
+	for _, block := range callee.Blocks {
+		for _, inner := range block.Instrs {
+			hits = append(hits, t.sinksWithin(inner, depth-1, visited)...)
+		}
+	}
+	return hits
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package tracker
+
+import (
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/collector"
+	"strings"
+)
+
+// DefaultBarriers are the functions whose arguments do not propagate the taint:
+// the tracker neither looks into them nor taints their results.
+// A pattern is a package path, which matches the functions and methods of the package
+// and of the packages under it, or a package path followed by a name prefix, e.g.
+// "k8s.io/client-go/tools/record.EventRecorder" for the methods of EventRecorder.
+// The paths are matched with collector.MatchPath.
+var DefaultBarriers = []string{
+	"k8s.io/klog",
+	"k8s.io/component-base/metrics",
+	"github.com/prometheus/client_golang",
+	"k8s.io/apimachinery/pkg/util/runtime.HandleError",
+	"k8s.io/client-go/tools/record.EventRecorder",
+	"k8s.io/client-go/tools/events.EventRecorder",
+	"fmt.Errorf",
+}
+
+// DefaultSanitizers are the functions whose results are clean even when their
+// arguments are tainted. Their bodies are still tracked. The patterns are the ones
+// of DefaultBarriers: "k8s.io/apimachinery/pkg/api/errors.Is" matches its Is* predicates,
+// e.g. IsNotFound.
+var DefaultSanitizers = []string{
+	"errors.Is",
+	"errors.As",
+	"k8s.io/apimachinery/pkg/api/errors.Is",
+}
+
+// Reader models the read points of a field the tracker cannot find by itself: in the
+// method Method of Type, the results of the invoked methods named Call read the field
+// number Field of Type. E.g. the Schedule calls of scheduleOne read the cache of the
+// scheduler, its first field, written by the handlers.
+type Reader struct {
+	Type   string
+	Method string
+	Call   string
+	Field  int
+}
+
+// Budgets bound the work of the tracker on large packages. Zero means no bound.
+type Budgets struct {
+	// Functions bounds the functions searched for the members written by an entry point.
+	Functions int
+	// Depth bounds the nesting of the callees the taint is followed into.
+	Depth int
+	// Guards bounds the nesting of the callees of a guarded call searched for sinks.
+	Guards int
+}
+
+// calleeMember returns the package of the function or method called and its name
+// within the package, e.g. "EventRecorder.Eventf" for a method.
+func calleeMember(common *ssa.CallCommon) (string, string) {
+	var fn *types.Func
+	var recv types.Type
+	if common.IsInvoke() {
+		fn, recv = common.Method, common.Value.Type()
+	} else if callee := common.StaticCallee(); callee != nil {
+		obj, ok := callee.Object().(*types.Func)
+		if !ok {
+			// closures and wrappers are matched by the name of their package
+			if callee.Pkg == nil {
+				return "", ""
+			}
+			return callee.Pkg.Pkg.Path(), callee.Name()
+		}
+		fn = obj
+		if sig := callee.Signature; sig.Recv() != nil {
+			recv = sig.Recv().Type()
+		}
+	}
+	if fn == nil || fn.Pkg() == nil {
+		return "", ""
+	}
+	member := fn.Name()
+	if recv != nil {
+		if named, ok := DerefType(recv).(*types.Named); ok {
+			member = named.Obj().Name() + "." + member
+		}
+	}
+	return fn.Pkg().Path(), member
+}
+
+// matchAny tells whether the member of the package matches one of the patterns,
+// see DefaultBarriers.
+func matchAny(pkg, member string, patterns []string) bool {
+	if pkg == "" {
+		return false
+	}
+	for _, p := range patterns {
+		path, prefix := splitPattern(p)
+		if prefix == "" {
+			if collector.MatchPath(pkg, path) || collector.MatchPath(pkg, path+"/") {
+				return true
+			}
+		} else if collector.MatchPath(pkg, path) && strings.HasPrefix(member, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPattern splits a pattern into its package path and its name prefix, which
+// follows the first dot of the last element of the path.
+func splitPattern(pattern string) (string, string) {
+	last := strings.LastIndex(pattern, "/") + 1
+	if i := strings.Index(pattern[last:], "."); i >= 0 {
+		return pattern[:last+i], pattern[last+i+1:]
+	}
+	return pattern, ""
+}
+
+func (t *Tracker) isBarrier(common *ssa.CallCommon) bool {
+	pkg, member := calleeMember(common)
+	return matchAny(pkg, member, t.barriers)
+}
+
+func (t *Tracker) isSanitizer(common *ssa.CallCommon) bool {
+	pkg, member := calleeMember(common)
+	return matchAny(pkg, member, t.sanitizers)
+}
+
+// AddBarriers adds patterns to the barrier functions, see DefaultBarriers.
+func (t *Tracker) AddBarriers(patterns ...string) {
+	t.barriers = append(t.barriers, patterns...)
+}
+
+// AddSanitizers adds patterns to the sanitizer functions, see DefaultSanitizers.
+func (t *Tracker) AddSanitizers(patterns ...string) {
+	t.sanitizers = append(t.sanitizers, patterns...)
+}
+
+// AddReaders adds models of read points, see Reader.
+func (t *Tracker) AddReaders(readers ...Reader) {
+	t.readers = append(t.readers, readers...)
+}
+
+// AddContainers adds models of containers, see DefaultContainers.
+func (t *Tracker) AddContainers(containers ...Container) {
+	t.containers = append(t.containers, containers...)
+}
+
+// SetBudgets sets the bounds of the tracker, see Budgets.
+func (t *Tracker) SetBudgets(budgets Budgets) {
+	t.budgets = budgets
+}
+
+// taintedReturn returns a tainted value returned by fun, if any.
+func taintedReturn(fun *ssa.Function, taintedVars map[ssa.Value]*taint) ssa.Value {
+	for _, block := range fun.Blocks {
+		if len(block.Instrs) == 0 {
+			continue
+		}
+		ret, ok := block.Instrs[len(block.Instrs)-1].(*ssa.Return)
+		if !ok {
+			continue
+		}
+		for _, res := range ret.Results {
+			if _, found := taintedVars[res]; found {
+				return res
+			}
+		}
+	}
+	return nil
+}
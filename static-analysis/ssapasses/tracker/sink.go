@@ -0,0 +1,406 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/collector"
+	"sort"
+	"strings"
+)
+
+// Part is the part of an API object that a sink mutates.
+type Part string
+
+const (
+	PartSpec        Part = "spec"
+	PartStatus      Part = "status"
+	PartMetadata    Part = "metadata"
+	PartSubresource Part = "subresource"
+	// PartObject is used by calls that create or delete the whole object.
+	PartObject Part = "object"
+)
+
+// typedClientPkg is the prefix of the packages holding the typed clientsets.
+const typedClientPkg = "k8s.io/client-go/kubernetes/typed/"
+
+// Sink describes a termination of the tracker: an API call (or the payload
+// built for it) which changes some resource on the apiserver.
+type Sink struct {
+	Resource    string
+	Part        Part
+	Subresource string
+}
+
+func (s Sink) String() string {
+	if s.Part == PartSubresource {
+		return fmt.Sprintf("%s/%s", s.Resource, s.Subresource)
+	}
+	return fmt.Sprintf("%s %s", s.Resource, s.Part)
+}
+
+// SinkHit is a sink reached by tainted values.
+type SinkHit struct {
+	Instr ssa.Instruction
+	Sink  Sink
+	// Fields lists the fields of the payload which are derived from tainted values.
+	// It is only filled when the payload is built in the same function as the sink.
+	Fields []string
+	// Sources lists the access paths of the informer object which influence the sink,
+	// e.g. "obj.ObjectMeta.Name". "obj" means the object is used as a whole.
+	Sources []string
+	// Witness is a chain of tainted values from a read point to the sink.
+	Witness []ssa.Value
+}
+
+// defaultPayloadSinks maps the type of a payload to the sink it is built for.
+// The types are matched without their vendor prefixes, see collector.MatchPath.
+var defaultPayloadSinks = map[string]Sink{
+	"k8s.io/api/core/v1.Binding":         {Resource: "Pod", Part: PartSubresource, Subresource: "binding"},
+	"k8s.io/api/policy/v1beta1.Eviction": {Resource: "Pod", Part: PartSubresource, Subresource: "eviction"},
+	"k8s.io/api/policy/v1.Eviction":      {Resource: "Pod", Part: PartSubresource, Subresource: "eviction"},
+}
+
+// defaultMethodSinks maps the methods of the typed clients to the part they mutate.
+// The Resource is filled from the client type when the call is matched.
+var defaultMethodSinks = map[string]Sink{
+	"Create":           {Part: PartObject},
+	"Update":           {Part: PartSpec},
+	"UpdateStatus":     {Part: PartStatus},
+	"Patch":            {Part: PartSpec},
+	"Delete":           {Part: PartObject},
+	"DeleteCollection": {Part: PartObject},
+	"Bind":             {Part: PartSubresource, Subresource: "binding"},
+	"Evict":            {Part: PartSubresource, Subresource: "eviction"},
+}
+
+// AddPayloadSinks adds payload types to the catalog of terminations, see defaultPayloadSinks.
+func (t *Tracker) AddPayloadSinks(sinks map[string]Sink) {
+	for name, sink := range sinks {
+		t.payloadSinks[name] = sink
+	}
+}
+
+// AddMethodSinks adds methods of the typed clients to the catalog of terminations,
+// see defaultMethodSinks. The Resource of the sinks is ignored.
+func (t *Tracker) AddMethodSinks(sinks map[string]Sink) {
+	for name, sink := range sinks {
+		t.methodSinks[name] = sink
+	}
+}
+
+// DerefType returns the type pointed to by typ, or typ itself.
+func DerefType(typ types.Type) types.Type {
+	if ptr, ok := typ.Underlying().(*types.Pointer); ok {
+		return ptr.Elem()
+	}
+	return typ
+}
+
+func (t *Tracker) payloadSink(al *ssa.Alloc) (Sink, bool) {
+	typ := DerefType(al.Type()).String()
+	for name, sink := range t.payloadSinks {
+		if collector.MatchPath(typ, name) {
+			return sink, true
+		}
+	}
+	return Sink{}, false
+}
+
+// callArgs returns the arguments of the call without the receiver.
+func callArgs(common *ssa.CallCommon) []ssa.Value {
+	if !common.IsInvoke() && common.Signature().Recv() != nil && len(common.Args) > 0 {
+		return common.Args[1:]
+	}
+	return common.Args
+}
+
+func calleeName(common *ssa.CallCommon) string {
+	if common.IsInvoke() {
+		return common.Method.Name()
+	}
+	if callee := common.StaticCallee(); callee != nil {
+		return callee.Name()
+	}
+	return ""
+}
+
+// CallSink returns the sink the call terminates at, if the call is an API write of the catalog.
+func (t *Tracker) CallSink(common *ssa.CallCommon) (Sink, bool) {
+	named, method := methodOf(common)
+	if named == nil || !collector.MatchPath(named.Obj().Pkg().Path(), typedClientPkg) {
+		return Sink{}, false
+	}
+	sink, ok := t.methodSinks[method]
+	if !ok {
+		return Sink{}, false
+	}
+	sink.Resource = strings.TrimSuffix(named.Obj().Name(), "Interface")
+	if method == "Patch" {
+		sink = classifyPatch(sink, callArgs(common))
+	}
+	return sink, true
+}
+
+// classifyPatch looks at the subresources and the body of a Patch call to
+// find out which part of the object is patched.
+func classifyPatch(sink Sink, args []ssa.Value) Sink {
+	if len(args) == 0 {
+		return sink
+	}
+	for _, sub := range constantStrings(args[len(args)-1]) {
+		if sub == "status" {
+			sink.Part = PartStatus
+		} else {
+			sink.Part = PartSubresource
+			sink.Subresource = sub
+		}
+		return sink
+	}
+	if body := payloadArg(args, true); body != nil {
+		paths, _, _ := payloadPaths(body, nil)
+		if part, ok := partOf(paths); ok {
+			sink.Part = part
+		}
+	}
+	return sink
+}
+
+// preconditions are the paths of a patch which only guard it, e.g. the resourceVersion
+// of an optimistic concurrency patch. They do not tell the part patched.
+var preconditions = map[string]struct{}{
+	"metadata.resourceversion":   {},
+	"metadata.uid":               {},
+	"objectmeta.resourceversion": {},
+	"objectmeta.uid":             {},
+}
+
+// partOf returns the part shared by all the given paths, but the preconditions.
+// The paths spanning several parts patch the object.
+func partOf(paths []string) (Part, bool) {
+	var part Part
+	for _, p := range paths {
+		if _, found := preconditions[strings.ToLower(p)]; found {
+			continue
+		}
+		var cur Part
+		switch strings.ToLower(strings.Split(p, ".")[0]) {
+		case "metadata", "objectmeta":
+			cur = PartMetadata
+		case "status":
+			cur = PartStatus
+		case "spec":
+			cur = PartSpec
+		default:
+			continue
+		}
+		if part != "" && part != cur {
+			return PartObject, true
+		}
+		part = cur
+	}
+	return part, part != ""
+}
+
+// payloadArg returns the argument carrying the object (or the patch body) of a sink call.
+func payloadArg(args []ssa.Value, patch bool) ssa.Value {
+	for _, arg := range args {
+		if patch {
+			if s, ok := arg.Type().Underlying().(*types.Slice); ok {
+				if b, ok := s.Elem().Underlying().(*types.Basic); ok && b.Kind() == types.Byte {
+					return arg
+				}
+			}
+			continue
+		}
+		if ptr, ok := arg.Type().Underlying().(*types.Pointer); ok {
+			if _, ok := ptr.Elem().Underlying().(*types.Struct); ok {
+				return arg
+			}
+		}
+	}
+	return nil
+}
+
+// constantStrings returns the constant strings stored into a variadic slice.
+func constantStrings(v ssa.Value) []string {
+	sl, ok := v.(*ssa.Slice)
+	if !ok {
+		return nil
+	}
+	al, ok := sl.X.(*ssa.Alloc)
+	if !ok {
+		return nil
+	}
+	strs := []string{}
+	for _, ref := range *al.Referrers() {
+		ia, ok := ref.(*ssa.IndexAddr)
+		if !ok {
+			continue
+		}
+		for _, iref := range *ia.Referrers() {
+			if st, ok := iref.(*ssa.Store); ok {
+				if c, ok := st.Val.(*ssa.Const); ok && c.Value != nil && c.Value.Kind() == constant.String {
+					strs = append(strs, constant.StringVal(c.Value))
+				}
+			}
+		}
+	}
+	return strs
+}
+
+// payloadPaths walks a payload built in the current function and returns the
+// paths of all the fields it sets, the ones which are set from tainted values,
+// and those tainted values.
+func payloadPaths(v ssa.Value, taintedVars map[ssa.Value]*taint) ([]string, []string, []ssa.Value) {
+	all := map[string]struct{}{}
+	tainted := map[string]ssa.Value{}
+	walkPayload(v, "", taintedVars, all, tainted, map[ssa.Value]struct{}{})
+	fields := []string{}
+	values := []ssa.Value{}
+	for field, val := range tainted {
+		fields = append(fields, field)
+		values = append(values, val)
+	}
+	sort.Strings(fields)
+	return sortedKeys(all), fields, values
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func walkPayload(v ssa.Value, prefix string, taintedVars map[ssa.Value]*taint, all map[string]struct{}, tainted map[string]ssa.Value, seen map[ssa.Value]struct{}) {
+	if _, found := seen[v]; found {
+		return
+	}
+	seen[v] = struct{}{}
+	switch v.(type) {
+	case *ssa.Const:
+		c := v.(*ssa.Const)
+		if c.Value == nil || c.Value.Kind() != constant.String {
+			return
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal([]byte(constant.StringVal(c.Value)), &body); err != nil {
+			return
+		}
+		for key, val := range body {
+			if sub, ok := val.(map[string]interface{}); ok && len(sub) > 0 {
+				for subKey := range sub {
+					all[joinPath(joinPath(prefix, key), subKey)] = struct{}{}
+				}
+			} else {
+				all[joinPath(prefix, key)] = struct{}{}
+			}
+		}
+	case *ssa.Convert:
+		walkPayload(v.(*ssa.Convert).X, prefix, taintedVars, all, tainted, seen)
+	case *ssa.ChangeType:
+		walkPayload(v.(*ssa.ChangeType).X, prefix, taintedVars, all, tainted, seen)
+	case *ssa.MakeInterface:
+		walkPayload(v.(*ssa.MakeInterface).X, prefix, taintedVars, all, tainted, seen)
+	case *ssa.Slice:
+		walkPayload(v.(*ssa.Slice).X, prefix, taintedVars, all, tainted, seen)
+	case *ssa.UnOp:
+		// only copies of local composite literals are part of the payload
+		uo := v.(*ssa.UnOp)
+		if _, ok := uo.X.(*ssa.Alloc); ok && uo.Op == token.MUL {
+			walkPayload(uo.X, prefix, taintedVars, all, tainted, seen)
+		}
+	case *ssa.Extract:
+		walkPayload(v.(*ssa.Extract).Tuple, prefix, taintedVars, all, tainted, seen)
+	case *ssa.Call:
+		// json.Marshal(payload) is the usual way to build a patch body
+		call := v.(*ssa.Call)
+		if callee := call.Common().StaticCallee(); callee != nil && callee.Name() == "Marshal" && len(call.Common().Args) == 1 {
+			walkPayload(call.Common().Args[0], prefix, taintedVars, all, tainted, seen)
+		}
+	case *ssa.Alloc, *ssa.MakeMap:
+		for _, ref := range *v.Referrers() {
+			switch ref.(type) {
+			case *ssa.FieldAddr:
+				fa := ref.(*ssa.FieldAddr)
+				st, ok := DerefType(fa.X.Type()).Underlying().(*types.Struct)
+				if !ok {
+					continue
+				}
+				walkPayload(fa, joinPath(prefix, st.Field(fa.Field).Name()), taintedVars, all, tainted, seen)
+			case *ssa.MapUpdate:
+				mu := ref.(*ssa.MapUpdate)
+				c, ok := mu.Key.(*ssa.Const)
+				if !ok || c.Value == nil || c.Value.Kind() != constant.String {
+					continue
+				}
+				recordField(mu.Value, joinPath(prefix, constant.StringVal(c.Value)), taintedVars, all, tainted, seen)
+			}
+		}
+	case *ssa.FieldAddr:
+		for _, ref := range *v.Referrers() {
+			switch ref.(type) {
+			case *ssa.FieldAddr:
+				fa := ref.(*ssa.FieldAddr)
+				st, ok := DerefType(fa.X.Type()).Underlying().(*types.Struct)
+				if !ok {
+					continue
+				}
+				walkPayload(fa, joinPath(prefix, st.Field(fa.Field).Name()), taintedVars, all, tainted, seen)
+			case *ssa.Store:
+				st := ref.(*ssa.Store)
+				if st.Addr == v {
+					recordField(st.Val, prefix, taintedVars, all, tainted, seen)
+				}
+			}
+		}
+	default:
+	}
+}
+
+// recordField records the field at path set to val. Nested payloads are walked
+// so that the deepest fields are reported.
+func recordField(val ssa.Value, path string, taintedVars map[ssa.Value]*taint, all map[string]struct{}, tainted map[string]ssa.Value, seen map[ssa.Value]struct{}) {
+	nested := map[string]struct{}{}
+	walkPayload(val, path, taintedVars, nested, tainted, seen)
+	if len(nested) != 0 {
+		for p := range nested {
+			all[p] = struct{}{}
+		}
+		return
+	}
+	all[path] = struct{}{}
+	for {
+		if _, found := taintedVars[val]; found {
+			tainted[path] = val
+			return
+		}
+		switch val.(type) {
+		case *ssa.MakeInterface:
+			val = val.(*ssa.MakeInterface).X
+		case *ssa.ChangeType:
+			val = val.(*ssa.ChangeType).X
+		case *ssa.Convert:
+			val = val.(*ssa.Convert).X
+		default:
+			return
+		}
+	}
+}
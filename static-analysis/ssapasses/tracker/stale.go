@@ -0,0 +1,161 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package tracker
+
+import (
+	"fmt"
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"io"
+	"kubetorch/ssapasses/collector"
+	"os"
+)
+
+const (
+	listersPkg = "k8s.io/client-go/listers/"
+	cachePkg   = "k8s.io/client-go/tools/cache"
+)
+
+// cacheReadMethods are the methods of the listers and indexers returning cached objects.
+var cacheReadMethods = map[string]struct{}{
+	"Get":      {},
+	"List":     {},
+	"GetByKey": {},
+	"ByIndex":  {},
+	"Index":    {},
+}
+
+// StaleRead is a read of an informer cache flowing into a sink: the decision
+// taken by the sink could act on a stale state of the cache.
+type StaleRead struct {
+	Read *ssa.Call
+	// Kind is the kind of the objects cached by the informer, e.g. "Pod".
+	// It is empty when the kind cannot be found, e.g. an untyped indexer never asserted.
+	Kind string
+	Hit  SinkHit
+}
+
+// methodOf returns the named type of the receiver and the name of the method called.
+func methodOf(common *ssa.CallCommon) (*types.Named, string) {
+	var recv types.Type
+	var method string
+	if common.IsInvoke() {
+		recv = common.Value.Type()
+		method = common.Method.Name()
+	} else if callee := common.StaticCallee(); callee != nil && callee.Signature.Recv() != nil {
+		recv = callee.Signature.Recv().Type()
+		method = callee.Name()
+	} else {
+		return nil, ""
+	}
+	named, ok := DerefType(recv).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return nil, ""
+	}
+	return named, method
+}
+
+// IsCacheRead tells whether the call reads a lister or an indexer of an informer.
+func IsCacheRead(common *ssa.CallCommon) bool {
+	named, method := methodOf(common)
+	if named == nil {
+		return false
+	}
+	if _, ok := cacheReadMethods[method]; !ok {
+		return false
+	}
+	path := named.Obj().Pkg().Path()
+	return collector.MatchPath(path, listersPkg) || collector.MatchPath(path, cachePkg)
+}
+
+// objectKind returns the kind of the API object typ holds, e.g. "Pod" for []*v1.Pod.
+func objectKind(typ types.Type) string {
+	if tuple, ok := typ.(*types.Tuple); ok {
+		if tuple.Len() == 0 {
+			return ""
+		}
+		typ = tuple.At(0).Type()
+	}
+	if slice, ok := typ.Underlying().(*types.Slice); ok {
+		typ = slice.Elem()
+	}
+	if named, ok := DerefType(typ).(*types.Named); ok && IsAPIObject(named) {
+		return named.Obj().Name()
+	}
+	return ""
+}
+
+// cacheKind returns the kind of the objects read by the call. The listers are typed,
+// while the objects got from an indexer are asserted to their type later on.
+// It returns "" for the objects of an indexer which are never asserted.
+func cacheKind(call *ssa.Call) string {
+	if kind := objectKind(call.Type()); kind != "" {
+		return kind
+	}
+	visited := map[ssa.Value]struct{}{}
+	stack := []ssa.Value{call}
+	for len(stack) != 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, found := visited[cur]; found || cur.Referrers() == nil {
+			continue
+		}
+		visited[cur] = struct{}{}
+		for _, ref := range *cur.Referrers() {
+			switch ref.(type) {
+			case *ssa.TypeAssert:
+				if kind := objectKind(ref.(*ssa.TypeAssert).AssertedType); kind != "" {
+					return kind
+				}
+			case *ssa.Extract, *ssa.IndexAddr, *ssa.Index, *ssa.UnOp:
+				stack = append(stack, ref.(ssa.Value))
+			}
+		}
+	}
+	return ""
+}
+
+// StaleReads returns the lister and indexer reads of the package which flow into sinks.
+func (t *Tracker) StaleReads() []StaleRead {
+	reads := []StaleRead{}
+	if pkg := collector.PackageOf(t.prog, t.pattern); pkg != nil {
+		for _, fun := range collector.PackageFunctions(t.prog, pkg) {
+			for _, block := range fun.Blocks {
+				for _, instr := range block.Instrs {
+					call, ok := instr.(*ssa.Call)
+					if !ok || !IsCacheRead(call.Common()) {
+						continue
+					}
+					hits, _ := t.taintFrom(fun, []ssa.Value{call})
+					kind := cacheKind(call)
+					for _, hit := range hits {
+						reads = append(reads, StaleRead{Read: call, Kind: kind, Hit: hit})
+					}
+				}
+			}
+		}
+	}
+	return reads
+}
+
+// TrackStaleReads prints the decisions which could act on a stale state of the informer caches.
+func (t *Tracker) TrackStaleReads() {
+	t.FprintStaleReads(os.Stdout, t.StaleReads())
+}
+
+// FprintStaleReads writes the stale reads to w.
+func (t *Tracker) FprintStaleReads(w io.Writer, reads []StaleRead) {
+	fmt.Fprintln(w, separator)
+	fmt.Fprintln(w, "HINT: resources could be changed from a stale cache read by:")
+	for _, read := range reads {
+		kind := read.Kind
+		if kind == "" {
+			kind = "unknown"
+		}
+		fmt.Fprintf(w, "  cache read of %s at %v: %v\n", kind, t.prog.Fset.Position(read.Read.Pos()), read.Read)
+		fmt.Fprintf(w, "    -> %v write to %s at %v: %v\n", read.Hit.Sink.Part, read.Hit.Sink,
+			t.prog.Fset.Position(read.Hit.Instr.Pos()), read.Hit.Instr)
+	}
+}
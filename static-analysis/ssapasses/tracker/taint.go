@@ -0,0 +1,204 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package tracker
+
+import (
+	"github.com/golang-collections/go-datastructures/queue"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"sort"
+)
+
+// RootPath is the access path of the object delivered by the informer.
+const RootPath = "obj"
+
+// taint is what the tracker knows about a tainted value.
+type taint struct {
+	// path is the access path of the value from the informer object, e.g. "obj.Spec.NodeName".
+	// It is empty when the value is not a plain selection of the object, e.g. a new Binding.
+	path string
+	// parents are the tainted values this value is derived from.
+	parents []ssa.Value
+}
+
+// flow is an edge of the taint propagation: ref uses the tainted value from.
+type flow struct {
+	ref  ssa.Instruction
+	from ssa.Value
+}
+
+func (tt *taint) addParent(from ssa.Value) {
+	for _, p := range tt.parents {
+		if p == from {
+			return
+		}
+	}
+	tt.parents = append(tt.parents, from)
+}
+
+// IsAPIObject tells whether typ is (a pointer to) a Kubernetes API object,
+// i.e. a struct embedding ObjectMeta.
+func IsAPIObject(typ types.Type) bool {
+	st, ok := DerefType(typ).Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i).Anonymous() && st.Field(i).Name() == "ObjectMeta" {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldName returns the name of the field of the struct x points to, or "?".
+func FieldName(x ssa.Value, field int) string {
+	st, ok := DerefType(x.Type()).Underlying().(*types.Struct)
+	if !ok {
+		return "?"
+	}
+	return st.Field(field).Name()
+}
+
+// derivePath returns the access path of v when it is derived from the tainted value from.
+func derivePath(from *taint, v ssa.Value) string {
+	if from == nil || from.path == "" {
+		return ""
+	}
+	path := ""
+	switch v.(type) {
+	case *ssa.FieldAddr:
+		fa := v.(*ssa.FieldAddr)
+		path = from.path + "." + FieldName(fa.X, fa.Field)
+	case *ssa.Field:
+		f := v.(*ssa.Field)
+		path = from.path + "." + FieldName(f.X, f.Field)
+	case *ssa.UnOp:
+		if v.(*ssa.UnOp).Op != token.MUL {
+			return ""
+		}
+		path = from.path
+	case *ssa.Parameter, *ssa.FreeVar, *ssa.ChangeType, *ssa.MakeInterface, *ssa.TypeAssert:
+		path = from.path
+	case *ssa.Extract:
+		// only the object returned by a lookup keeps a path, not e.g. the error
+		if !IsAPIObject(v.Type()) {
+			return ""
+		}
+	default:
+		return ""
+	}
+	// podInfo.Pod is the object itself: restart the path from there
+	if IsAPIObject(v.Type()) {
+		return RootPath
+	}
+	return path
+}
+
+// taintValue marks v as tainted by from and reports whether v was not tainted before.
+func taintValue(taintedVars map[ssa.Value]*taint, v, from ssa.Value) bool {
+	if tt, found := taintedVars[v]; found {
+		if from != nil {
+			tt.addParent(from)
+		}
+		return false
+	}
+	tt := &taint{}
+	if from != nil {
+		tt.path = derivePath(taintedVars[from], v)
+		tt.parents = []ssa.Value{from}
+	}
+	taintedVars[v] = tt
+	return true
+}
+
+func putReferrers(q *queue.Queue, v ssa.Value) {
+	for _, ref := range *(v.Referrers()) {
+		q.Put(flow{ref: ref, from: v})
+	}
+}
+
+// sourcesOf returns the access paths of the informer object which flow into v.
+func sourcesOf(v ssa.Value, taintedVars map[ssa.Value]*taint) []string {
+	sources := map[string]struct{}{}
+	visited := map[ssa.Value]struct{}{}
+	stack := []ssa.Value{v}
+	for len(stack) != 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, found := visited[cur]; found {
+			continue
+		}
+		visited[cur] = struct{}{}
+		tt, found := taintedVars[cur]
+		if !found {
+			continue
+		}
+		if tt.path != "" {
+			sources[tt.path] = struct{}{}
+			continue
+		}
+		stack = append(stack, tt.parents...)
+	}
+	keys := []string{}
+	for k := range sources {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// witnessOf returns a shortest chain of tainted values from a read point to v.
+func witnessOf(v ssa.Value, taintedVars map[ssa.Value]*taint) []ssa.Value {
+	next := map[ssa.Value]ssa.Value{v: nil}
+	worklist := []ssa.Value{v}
+	for len(worklist) != 0 {
+		cur := worklist[0]
+		worklist = worklist[1:]
+		tt, found := taintedVars[cur]
+		if !found {
+			continue
+		}
+		if len(tt.parents) == 0 {
+			chain := []ssa.Value{}
+			for ; cur != nil; cur = next[cur] {
+				chain = append(chain, cur)
+			}
+			return chain
+		}
+		for _, p := range tt.parents {
+			if _, seen := next[p]; !seen {
+				next[p] = cur
+				worklist = append(worklist, p)
+			}
+		}
+	}
+	return nil
+}
+
+// taintFrom starts the taint analysis from the read points of fun and returns the sinks
+// reached, and the sinks guarded by tainted branches when implicit flow is enabled.
+func (t *Tracker) taintFrom(fun *ssa.Function, readPoints []ssa.Value) ([]SinkHit, []GuardedHit) {
+	taintedVars := map[ssa.Value]*taint{}
+	for _, rp := range readPoints {
+		taintedVars[rp] = &taint{path: RootPath}
+	}
+	hits := t.resolvePayloads(t.trackReadPointWithinMethod(fun, readPoints, taintedVars, 0), taintedVars)
+	for i := range hits {
+		v, ok := hits[i].Instr.(ssa.Value)
+		if !ok {
+			t.diagnose(hits[i].Instr.Parent(), hits[i].Instr.Pos(), "sink %v: it is not a value, its sources are not recorded", hits[i].Instr)
+			continue
+		}
+		hits[i].Sources = sourcesOf(v, taintedVars)
+		hits[i].Witness = witnessOf(v, taintedVars)
+	}
+	guarded := []GuardedHit{}
+	if t.implicitFlow {
+		guarded = t.trackControlDependence(taintedVars)
+	}
+	return hits, guarded
+}
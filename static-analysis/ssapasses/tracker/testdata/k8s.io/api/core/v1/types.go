@@ -0,0 +1,44 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package v1
+
+import (
+	metav1 "kubetorch/ssapasses/tracker/testdata/k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type PodSpec struct {
+	NodeName string
+}
+
+type PodStatus struct {
+	Phase string
+}
+
+type Pod struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+	Spec   PodSpec
+	Status PodStatus
+}
+
+type ObjectReference struct {
+	Kind string
+	Name string
+}
+
+type Binding struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+	Target ObjectReference
+}
+
+func (in *Pod) DeepCopy() *Pod {
+	if in == nil {
+		return nil
+	}
+	out := new(Pod)
+	*out = *in
+	return out
+}
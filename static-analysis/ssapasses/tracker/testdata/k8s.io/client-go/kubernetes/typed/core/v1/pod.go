@@ -0,0 +1,21 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package v1
+
+import (
+	"context"
+	v1 "kubetorch/ssapasses/tracker/testdata/k8s.io/api/core/v1"
+	metav1 "kubetorch/ssapasses/tracker/testdata/k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubetorch/ssapasses/tracker/testdata/k8s.io/apimachinery/pkg/types"
+)
+
+type PodInterface interface {
+	Create(ctx context.Context, pod *v1.Pod, opts metav1.CreateOptions) (*v1.Pod, error)
+	Update(ctx context.Context, pod *v1.Pod, opts metav1.UpdateOptions) (*v1.Pod, error)
+	UpdateStatus(ctx context.Context, pod *v1.Pod, opts metav1.UpdateOptions) (*v1.Pod, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*v1.Pod, error)
+	Bind(ctx context.Context, binding *v1.Binding, opts metav1.CreateOptions) error
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package cache
+
+import (
+	"fmt"
+)
+
+type ResourceEventHandler interface {
+	OnAdd(obj interface{})
+	OnUpdate(oldObj, newObj interface{})
+	OnDelete(obj interface{})
+}
+
+type ResourceEventHandlerFuncs struct {
+	AddFunc    func(obj interface{})
+	UpdateFunc func(oldObj, newObj interface{})
+	DeleteFunc func(obj interface{})
+}
+
+func (r ResourceEventHandlerFuncs) OnAdd(obj interface{}) {}
+
+func (r ResourceEventHandlerFuncs) OnUpdate(oldObj, newObj interface{}) {}
+
+func (r ResourceEventHandlerFuncs) OnDelete(obj interface{}) {}
+
+type SharedIndexInformer interface {
+	AddEventHandler(handler ResourceEventHandler)
+}
+
+type DeletedFinalStateUnknown struct {
+	Key string
+	Obj interface{}
+}
+
+type metaObject interface {
+	GetName() string
+	GetNamespace() string
+}
+
+func MetaNamespaceKeyFunc(obj interface{}) (string, error) {
+	if key, ok := obj.(DeletedFinalStateUnknown); ok {
+		return key.Key, nil
+	}
+	meta, ok := obj.(metaObject)
+	if !ok {
+		return "", fmt.Errorf("object has no meta")
+	}
+	if meta.GetNamespace() == "" {
+		return meta.GetName(), nil
+	}
+	return meta.GetNamespace() + "/" + meta.GetName(), nil
+}
+
+func SplitMetaNamespaceKey(key string) (namespace, name string, err error) {
+	for i := 0; i < len(key); i++ {
+		if key[i] == '/' {
+			return key[:i], key[i+1:], nil
+		}
+	}
+	return "", key, nil
+}
+
+type Indexer interface {
+	GetByKey(key string) (item interface{}, exists bool, err error)
+	ByIndex(indexName, indexedValue string) ([]interface{}, error)
+}
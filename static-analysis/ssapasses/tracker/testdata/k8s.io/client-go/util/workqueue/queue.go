@@ -0,0 +1,22 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package workqueue
+
+import (
+	"time"
+)
+
+type Interface interface {
+	Add(item interface{})
+	Get() (item interface{}, shutdown bool)
+	Done(item interface{})
+}
+
+type RateLimitingInterface interface {
+	Interface
+	AddAfter(item interface{}, duration time.Duration)
+	AddRateLimited(item interface{})
+	Forget(item interface{})
+}
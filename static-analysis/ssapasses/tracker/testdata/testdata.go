@@ -0,0 +1,154 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package testdata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	v1 "kubetorch/ssapasses/tracker/testdata/k8s.io/api/core/v1"
+	metav1 "kubetorch/ssapasses/tracker/testdata/k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubetorch/ssapasses/tracker/testdata/k8s.io/apimachinery/pkg/types"
+	corev1 "kubetorch/ssapasses/tracker/testdata/k8s.io/client-go/kubernetes/typed/core/v1"
+	"kubetorch/ssapasses/tracker/testdata/k8s.io/client-go/tools/cache"
+)
+
+type controller struct {
+	client corev1.PodInterface
+}
+
+type queuedPodInfo struct {
+	Pod      *v1.Pod
+	Attempts int
+}
+
+func addAllEventHandlers(c *Controller, podInformer cache.SharedIndexInformer) {
+	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.addPod,
+	})
+}
+
+func (c *controller) bind(pod *v1.Pod, node string) {
+	binding := &v1.Binding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID},
+		Target:     v1.ObjectReference{Kind: "Node", Name: node},
+	}
+	c.client.Bind(context.TODO(), binding, metav1.CreateOptions{})
+}
+
+func (c *controller) bindQueued(info *queuedPodInfo) {
+	c.bind(info.Pod, info.Pod.Spec.NodeName)
+}
+
+func (c *controller) updateStatus(pod *v1.Pod) {
+	c.client.UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{})
+}
+
+func (c *controller) updateSpec(pod *v1.Pod) {
+	c.client.Update(context.TODO(), pod, metav1.UpdateOptions{})
+}
+
+func (c *controller) removeFinalizers(pod *v1.Pod) {
+	data := []byte(`{"metadata":{"finalizers":null}}`)
+	c.client.Patch(context.TODO(), pod.Name, types.MergePatchType, data, metav1.PatchOptions{})
+}
+
+func (c *controller) patchLabels(pod *v1.Pod) {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": pod.Labels,
+		},
+	}
+	data, _ := json.Marshal(patch)
+	c.client.Patch(context.TODO(), pod.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{})
+}
+
+func (c *controller) patchStatus(pod *v1.Pod) {
+	c.client.Patch(context.TODO(), pod.Name, types.MergePatchType, []byte(`{"phase":"Failed"}`), metav1.PatchOptions{}, "status")
+}
+
+func (c *controller) patchStatusWithVersion(pod *v1.Pod) {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": pod.ResourceVersion,
+		},
+		"status": map[string]interface{}{
+			"phase": "Failed",
+		},
+	}
+	data, _ := json.Marshal(patch)
+	c.client.Patch(context.TODO(), pod.Name, types.MergePatchType, data, metav1.PatchOptions{})
+}
+
+func (c *controller) patchStatusWithUID(pod *v1.Pod) {
+	patch := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{UID: pod.UID},
+		Status:     v1.PodStatus{Phase: "Failed"},
+	}
+	data, _ := json.Marshal(patch)
+	c.client.Patch(context.TODO(), pod.Name, types.MergePatchType, data, metav1.PatchOptions{})
+}
+
+func (c *controller) patchSpecAndStatus(pod *v1.Pod) {
+	data := []byte(`{"spec":{"nodeName":""},"status":{"phase":"Pending"}}`)
+	c.client.Patch(context.TODO(), pod.Name, types.MergePatchType, data, metav1.PatchOptions{})
+}
+
+func (c *controller) deleteIfUnscheduled(pod *v1.Pod) {
+	if pod.Spec.NodeName != "" {
+		return
+	}
+	c.client.Delete(context.TODO(), "placeholder", metav1.DeleteOptions{})
+}
+
+func (c *controller) deleteByPhase(pod *v1.Pod) {
+	name := "running"
+	if pod.Status.Phase == "Failed" {
+		name = "failed"
+	}
+	c.client.Delete(context.TODO(), name, metav1.DeleteOptions{})
+}
+
+func (c *controller) deleteForever(pod *v1.Pod) {
+	for {
+		if pod.Spec.NodeName == "" {
+			nameOf(pod)
+		}
+		c.client.Delete(context.TODO(), "placeholder", metav1.DeleteOptions{})
+	}
+}
+
+func nameOf(pod *v1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+func hashOf(pod *v1.Pod) string {
+	return pod.Name
+}
+
+func (c *controller) deleteByName(pod *v1.Pod) {
+	c.client.Delete(context.TODO(), nameOf(pod), metav1.DeleteOptions{})
+}
+
+func (c *controller) deleteByKey(pod *v1.Pod) {
+	c.client.Delete(context.TODO(), pod.Namespace+"/"+pod.Name, metav1.DeleteOptions{})
+}
+
+func (c *controller) deleteByMergedName(pod *v1.Pod, named bool) {
+	name := "placeholder"
+	if named {
+		name = pod.Name
+	}
+	c.client.Delete(context.TODO(), name, metav1.DeleteOptions{})
+}
+
+func (c *controller) deleteByError(pod *v1.Pod) {
+	err := fmt.Errorf("cannot handle %s", pod.Name)
+	c.client.Delete(context.TODO(), err.Error(), metav1.DeleteOptions{})
+}
+
+func (c *controller) deleteByHash(pod *v1.Pod) {
+	c.client.Delete(context.TODO(), hashOf(pod), metav1.DeleteOptions{})
+}
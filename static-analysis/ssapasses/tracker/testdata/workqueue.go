@@ -0,0 +1,104 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package testdata
+
+import (
+	"context"
+	v1 "kubetorch/ssapasses/tracker/testdata/k8s.io/api/core/v1"
+	metav1 "kubetorch/ssapasses/tracker/testdata/k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "kubetorch/ssapasses/tracker/testdata/k8s.io/client-go/kubernetes/typed/core/v1"
+	listers "kubetorch/ssapasses/tracker/testdata/k8s.io/client-go/listers/core/v1"
+	"kubetorch/ssapasses/tracker/testdata/k8s.io/client-go/tools/cache"
+	"kubetorch/ssapasses/tracker/testdata/k8s.io/client-go/util/workqueue"
+)
+
+// Controller is a typical workqueue based controller: the handlers enqueue
+// the keys and the workers sync the objects got from the lister.
+type Controller struct {
+	client    corev1.PodInterface
+	podLister listers.PodLister
+	// podIndexer indexes the pods by node
+	podIndexer cache.Indexer
+	queue      workqueue.RateLimitingInterface
+
+	syncHandler func(key string) error
+}
+
+func NewController(client corev1.PodInterface, podLister listers.PodLister, queue workqueue.RateLimitingInterface) *Controller {
+	c := &Controller{client: client, podLister: podLister, queue: queue}
+	c.syncHandler = c.syncPod
+	return c
+}
+
+func (c *Controller) addPod(obj interface{}) {
+	c.enqueue(obj)
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) worker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *Controller) processNextWorkItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.syncHandler(key.(string)); err != nil {
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) syncPod(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	pod, err := c.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	pod = pod.DeepCopy()
+	pod.Status.Phase = "Running"
+	_, err = c.client.UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *Controller) deletePodsOnNode(nodeName string) {
+	objs, err := c.podIndexer.ByIndex("node", nodeName)
+	if err != nil {
+		return
+	}
+	for _, obj := range objs {
+		pod := obj.(*v1.Pod)
+		c.client.Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+	}
+}
+
+func (c *Controller) deleteIndexedPod(key string) {
+	obj, exists, err := c.podIndexer.GetByKey(key)
+	if err != nil || !exists {
+		return
+	}
+	objKey, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	_, name, _ := cache.SplitMetaNamespaceKey(objKey)
+	c.client.Delete(context.TODO(), name, metav1.DeleteOptions{})
+}
@@ -7,9 +7,13 @@ package tracker
 import (
 	"fmt"
 	"github.com/golang-collections/go-datastructures/queue"
+	"go/token"
 	"go/types"
 	"golang.org/x/tools/go/ssa"
+	"io"
 	"kubetorch/ssapasses/collector"
+	"os"
+	"sort"
 	"strings"
 )
 
@@ -17,42 +21,65 @@ type Tracker struct {
 	pattern    string
 	prog       *ssa.Program
 	handlerMap map[*ssa.Call]map[string]*ssa.Function
+	triggerMap map[ssa.CallInstruction]map[string]*ssa.Function
+	entries    []collector.Entry
 	methodMap  map[string][]*ssa.Function
-	endpoints  map[string]struct{}
+	// fieldFuncs are the functions stored into struct fields, see workqueue.go
+	fieldFuncs map[FieldKey][]*ssa.Function
+	// callers are the callers of the functions called in each package, see concurrency.go
+	callers map[*ssa.Package]map[*ssa.Function][]*ssa.Function
+	// payloadSinks and methodSinks are the catalog of terminations, see sink.go
+	payloadSinks map[string]Sink
+	methodSinks  map[string]Sink
+	// implicitFlow enables the control dependence taint, see control.go
+	implicitFlow bool
+	// barriers and sanitizers stop the taint, see model.go
+	barriers   []string
+	sanitizers []string
+	// readers and containers model the read points, see model.go and workqueue.go
+	readers    []Reader
+	containers []Container
+	budgets    Budgets
+	// diagnostics are the constructs skipped while tracking
+	diagnostics []collector.Diagnostic
 }
 
 const separator = "========================================================================="
 
+// isWritten tells whether fa is stored to, or has an item put into its container.
+// The address may also be loaded, e.g. to append to the member.
 func (t *Tracker) isWritten(fa *ssa.FieldAddr) bool {
-	if len(*fa.Referrers()) != 1 {
-		panic("FieldAddr's referrer should be only 1")
-	}
-	instr := (*fa.Referrers())[0]
-	switch instr.(type) {
-	case *ssa.Store:
-		st := instr.(*ssa.Store)
-		if st.Addr == fa {
-			return true
-		}
-	case *ssa.UnOp:
-		uo := instr.(*ssa.UnOp)
-		uoR := (*uo.Referrers())[0]
-		if invoke, ok := uoR.(*ssa.Call); ok && invoke.Common().IsInvoke() && invoke.Common().Value == uo {
-			return true
+	for _, instr := range *fa.Referrers() {
+		switch instr := instr.(type) {
+		case *ssa.Store:
+			if instr.Addr == fa {
+				return true
+			}
+		case *ssa.UnOp:
+			if len(*instr.Referrers()) == 0 {
+				continue
+			}
+			uoR := (*instr.Referrers())[0]
+			if invoke, ok := uoR.(*ssa.Call); ok && invoke.Common().IsInvoke() && invoke.Common().Value == instr {
+				// only putting an item into a container writes it, e.g. Get is the matching read of a workqueue
+				if container, ok := containerOf(t.containers, fa.Type()); ok {
+					if collector.Contains(container.Writes, invoke.Common().Method.Name()) {
+						return true
+					}
+					continue
+				}
+				return true
+			}
 		}
-	default:
-		return false
 	}
 	return false
 }
 
-func (t *Tracker) trackSingleFunction(function *ssa.Function, funQ *queue.Queue, writtenMembers map[*ssa.FieldAddr]struct{}) {
-	if function.Signature.Recv() != nil {
-		//fmt.Println("type: ", function.Params[0].Type().String())
+func (t *Tracker) trackSingleFunction(function *ssa.Function, funQ *queue.Queue, visited map[*ssa.Function]struct{}, writtenMembers map[*ssa.FieldAddr]struct{}) {
+	if function.Signature.Recv() != nil && len(function.Params) != 0 {
 		for _, instr := range *(function.Params[0].Referrers()) {
 			switch instr.(type) {
 			case *ssa.FieldAddr:
-				//fmt.Printf("FA: %v\n", instr)
 				fa := instr.(*ssa.FieldAddr)
 				if t.isWritten(fa) {
 					writtenMembers[fa] = struct{}{}
@@ -67,12 +94,27 @@ func (t *Tracker) trackSingleFunction(function *ssa.Function, funQ *queue.Queue,
 			switch instr.(type) {
 			case *ssa.Call:
 				call := instr.(*ssa.Call)
-				if !call.Common().IsInvoke() {
-					// TODO: relax it later.
-					if strings.Contains(call.Common().String(),
-						"k8s.io/kubernetes/pkg/scheduler.Scheduler") {
-						funQ.Put(call.Common().StaticCallee())
+				callee := call.Common().StaticCallee()
+				if callee == nil {
+					continue
+				}
+				if _, found := visited[callee]; found {
+					continue
+				}
+				if len(callee.Blocks) == 0 {
+					if callee.Pkg != nil && callee.Pkg.Pkg.Path() == t.pattern {
+						t.diagnose(function, call.Pos(), "call of %s: it has no body, its writes are not tracked", callee)
 					}
+					continue
+				}
+				if t.budgets.Functions != 0 && len(visited) >= t.budgets.Functions {
+					continue
+				}
+				// the helpers of the handler, e.g. c.enqueue(obj), are declared in the same package,
+				// and the methods of the types of the readers are followed too
+				if (callee.Pkg != nil && callee.Pkg.Pkg.Path() == t.pattern) || t.onReaderType(call.Common()) {
+					visited[callee] = struct{}{}
+					funQ.Put(callee)
 				}
 			default:
 			}
@@ -80,62 +122,58 @@ func (t *Tracker) trackSingleFunction(function *ssa.Function, funQ *queue.Queue,
 	}
 }
 
-func (t *Tracker) findReadPoints(function *ssa.Function, writtenMembers map[*ssa.FieldAddr]struct{}, readMap map[*ssa.Function][]ssa.Value) {
-	//fmt.Println("finding read points in method: ", function.Name())
+// onReaderType tells whether the call is on one of the types of the readers.
+func (t *Tracker) onReaderType(common *ssa.CallCommon) bool {
+	for _, reader := range t.readers {
+		if strings.Contains(collector.TrimVendor(common.String()), collector.TrimVendor(reader.Type)) {
+			return true
+		}
+	}
+	return false
+}
+
+// findReadPoints finds the read points of the member modeled by the reader in function.
+func (t *Tracker) findReadPoints(function *ssa.Function, reader Reader, member *ssa.FieldAddr, readMap map[*ssa.Function][]ssa.Value) {
+	// It is very challenging to determine whether one member is read here, the reader tells it.
+	if !collector.MatchPath(DerefType(member.X.Type()).String(), reader.Type) || member.Field != reader.Field {
+		return
+	}
 	for _, block := range function.Blocks {
 		for _, instr := range block.Instrs {
 			call, ok := instr.(*ssa.Call)
-			if ok && call.Common().IsInvoke() {
-				// TODO: relax it later. So far let's only care about the method "invoke Schedule"
-				if call.Common().Method.Name() == "Schedule" {
-					//fmt.Println(call)
-					for member := range writtenMembers {
-						// TODO: relax it later. It is very challenging to determine whether one member is read here
-						if member.X.Type().String() == "*k8s.io/kubernetes/pkg/scheduler.Scheduler" &&
-							member.Field == 0 {
-							readMap[function] = append(readMap[function], call)
-						}
-					}
-				}
+			if ok && call.Common().IsInvoke() && call.Common().Method.Name() == reader.Call {
+				readMap[function] = append(readMap[function], call)
 			}
 		}
 	}
 }
 
-func (t *Tracker) trackReadPointWithinMethod(fun *ssa.Function, taintedVarsFromOuter map[ssa.Value]struct{}) []ssa.Instruction {
-
-	endpoints := []ssa.Instruction{}
-	taintedVars := taintedVarsFromOuter
-	//fmt.Println( "init tainted for ", fun.String(), " is ", taintedVars)
+func (t *Tracker) trackReadPointWithinMethod(fun *ssa.Function, seeds []ssa.Value, taintedVars map[ssa.Value]*taint, depth int) []SinkHit {
+	endpoints := []SinkHit{}
 
 	referrerQ := queue.New(100)
 
-	for key := range taintedVars {
-		for _, ref := range *(key.Referrers()) {
-			referrerQ.Put(ref)
-		}
+	for _, key := range seeds {
+		putReferrers(referrerQ, key)
 	}
 
 	for !referrerQ.Empty() {
-		refs, _ := referrerQ.Get(1)
-		ref := refs[0].(ssa.Instruction)
-		//fmt.Println(ref)
+		items, _ := referrerQ.Get(1)
+		edge := items[0].(flow)
+		ref := edge.ref
 		switch ref.(type) {
 		case *ssa.Alloc:
 			al := ref.(*ssa.Alloc)
-			if _, found := t.endpoints[al.String()]; found {
-				//fmt.Println("Reach endpoint!!!", al)
-				endpoints = append(endpoints, al)
-			}
-			taintedVars[al] = struct{}{}
-			for _, rref := range *(al.Referrers()) {
-				referrerQ.Put(rref)
+			if taintValue(taintedVars, al, edge.from) {
+				if sink, found := t.payloadSink(al); found {
+					endpoints = append(endpoints, SinkHit{Instr: al, Sink: sink})
+				}
+				putReferrers(referrerQ, al)
 			}
 		case *ssa.Extract:
 			ex := ref.(*ssa.Extract)
-			taintedVars[ex] = struct{}{}
-			for _, rref := range *(ex.Referrers()) {
-				referrerQ.Put(rref)
+			if taintValue(taintedVars, ex, edge.from) {
+				putReferrers(referrerQ, ex)
 			}
 		case *ssa.Store:
 			st := ref.(*ssa.Store)
@@ -153,156 +191,384 @@ func (t *Tracker) trackReadPointWithinMethod(fun *ssa.Function, taintedVarsFromO
 			// if "tainted" is a tainted variable, then t1 is also tainted here
 			// We need to do backtrack starting from st.Addr
 
-			if foundVal && !foundAddr {
-				taintedVars[st.Addr] = struct{}{}
+			if foundVal {
+				if foundAddr {
+					taintedVars[st.Addr].addParent(st.Val)
+				} else {
+					taintedVars[st.Addr] = &taint{parents: []ssa.Value{st.Val}}
+				}
 				back := stAddr
-				fa, fok := back.(*ssa.FieldAddr)
-				for fok {
-					back = fa.X
-					fa, fok = back.(*ssa.FieldAddr)
+				for {
+					if fa, ok := back.(*ssa.FieldAddr); ok {
+						back = fa.X
+					} else if ia, ok := back.(*ssa.IndexAddr); ok {
+						back = ia.X
+					} else {
+						break
+					}
 				}
-				if nw, ok := back.(*ssa.Alloc); ok {
-					referrerQ.Put(nw)
+				switch back.(type) {
+				case *ssa.Alloc:
+					referrerQ.Put(flow{ref: back.(*ssa.Alloc), from: st.Addr})
+				case *ssa.MakeSlice:
+					if taintValue(taintedVars, back, st.Addr) {
+						putReferrers(referrerQ, back)
+					}
 				}
 			}
 		case *ssa.FieldAddr:
 			fa := ref.(*ssa.FieldAddr)
-			taintedVars[fa] = struct{}{}
-			for _, rref := range *(fa.Referrers()) {
-				referrerQ.Put(rref)
+			if taintValue(taintedVars, fa, edge.from) {
+				putReferrers(referrerQ, fa)
 			}
 		case *ssa.UnOp:
 			uo := ref.(*ssa.UnOp)
-			taintedVars[uo] = struct{}{}
-			for _, rref := range *(uo.Referrers()) {
-				referrerQ.Put(rref)
+			if taintValue(taintedVars, uo, edge.from) {
+				putReferrers(referrerQ, uo)
+			}
+		case *ssa.BinOp:
+			// explicit flows, e.g. the key ns + "/" + name: only the branches on tainted
+			// conditions are the implicit flow, see control.go
+			bo := ref.(*ssa.BinOp)
+			if taintValue(taintedVars, bo, edge.from) {
+				putReferrers(referrerQ, bo)
+			}
+		case *ssa.Phi:
+			// a tainted value merged at a join, e.g. name := pod.Name; if ... { name = ... }
+			phi := ref.(*ssa.Phi)
+			if taintValue(taintedVars, phi, edge.from) {
+				putReferrers(referrerQ, phi)
+			}
+		case *ssa.Field, *ssa.IndexAddr, *ssa.Index, *ssa.Slice, *ssa.Lookup,
+			*ssa.Convert, *ssa.ChangeType, *ssa.MakeInterface, *ssa.TypeAssert:
+			// the key got from a workqueue is e.g. asserted, converted and sliced
+			v := ref.(ssa.Value)
+			if taintValue(taintedVars, v, edge.from) {
+				putReferrers(referrerQ, v)
+			}
+		case *ssa.MapUpdate:
+			mu := ref.(*ssa.MapUpdate)
+			if mu.Map != edge.from && taintValue(taintedVars, mu.Map, edge.from) {
+				putReferrers(referrerQ, mu.Map)
 			}
 		case *ssa.Call:
-			// conservative here: we don't track the referrers of Call for now
 			call := ref.(*ssa.Call)
-			innerTaintedVars := make(map[ssa.Value]struct{})
-			if call.Common().IsInvoke() {
-				// not support yet
+			if sink, found := t.CallSink(call.Common()); found {
+				if taintValue(taintedVars, call, edge.from) {
+					endpoints = append(endpoints, SinkHit{Instr: call, Sink: sink})
+				}
+			} else if t.isBarrier(call.Common()) {
+				// barriers neither propagate their arguments nor taint their results
 			} else {
-				// TODO: relax it later. So far hardcode "bind" as the end point
-				if callee, ok := call.Common().Value.(*ssa.Function); ok {
+				// conservative here: without the body of the callee (e.g. invoke),
+				// the results are assumed to depend on the arguments
+				result := edge.from
+				callees := t.Callees(call.Common())
+				if t.budgets.Depth != 0 && depth >= t.budgets.Depth {
+					callees = nil
+				}
+				if len(callees) != 0 {
+					result = nil
+				}
+				for _, callee := range callees {
+					innerSeeds := []ssa.Value{}
 					for i, ap := range call.Common().Args {
-						if _, found := taintedVars[ap]; found {
-							innerTaintedVars[callee.Params[i]] = struct{}{}
+						if _, found := taintedVars[ap]; found && i < len(callee.Params) {
+							if taintValue(taintedVars, callee.Params[i], ap) {
+								innerSeeds = append(innerSeeds, callee.Params[i])
+							}
 						}
 					}
-					//fmt.Println("tainted var for callee: ", innerTaintedVars)
-					innerEndPoints := t.trackReadPointWithinMethod(callee, innerTaintedVars)
+					innerEndPoints := t.trackReadPointWithinMethod(callee, innerSeeds, taintedVars, depth+1)
 					endpoints = append(endpoints, innerEndPoints...)
+					if ret := taintedReturn(callee, taintedVars); ret != nil && result == nil {
+						result = ret
+					}
+				}
+				if result != nil && !t.isSanitizer(call.Common()) && taintValue(taintedVars, call, result) {
+					// podLister.Pods(ns).Get(name) returns the object the key was computed from
+					if lookupByKey(call, taintedVars) {
+						taintedVars[call].path = RootPath
+					}
+					putReferrers(referrerQ, call)
 				}
 			}
 		case *ssa.MakeClosure:
 			// conservative here: we don't track the referrers of MakeClosure for now
 			mc := ref.(*ssa.MakeClosure)
-			innerTaintedVars := make(map[ssa.Value]struct{})
-			innerFun := mc.Fn.(*ssa.Function)
+			if t.budgets.Depth != 0 && depth >= t.budgets.Depth {
+				continue
+			}
+			innerSeeds := []ssa.Value{}
+			innerFun, ok := mc.Fn.(*ssa.Function)
+			if !ok || len(innerFun.FreeVars) != len(mc.Bindings) {
+				t.diagnose(fun, mc.Pos(), "closure %v: its function is unknown, its taint is not tracked", mc)
+				continue
+			}
 			for i, binding := range mc.Bindings {
 				if _, found := taintedVars[binding]; found {
-					innerTaintedVars[innerFun.FreeVars[i]] = struct{}{}
+					if taintValue(taintedVars, innerFun.FreeVars[i], binding) {
+						innerSeeds = append(innerSeeds, innerFun.FreeVars[i])
+					}
 				}
 			}
-			//fmt.Println("tainted var for inner func: ", innerTaintedVars)
-			innerEndPoints := t.trackReadPointWithinMethod(innerFun, innerTaintedVars)
+			innerEndPoints := t.trackReadPointWithinMethod(innerFun, innerSeeds, taintedVars, depth+1)
 			endpoints = append(endpoints, innerEndPoints...)
 		default:
 		}
 	}
-	//fmt.Println( "final tainted for ", fun.String(), " is ", taintedVars)
 	return endpoints
 }
 
-func (t *Tracker) trackSingleEntryPoint(function *ssa.Function) {
+// resolvePayloads reports the tainted fields of the payloads built in the
+// same function as their sink. A payload passed to a sink call is merged into that call.
+func (t *Tracker) resolvePayloads(endpoints []SinkHit, taintedVars map[ssa.Value]*taint) []SinkHit {
+	merged := map[ssa.Value]struct{}{}
+	for i := range endpoints {
+		call, ok := endpoints[i].Instr.(*ssa.Call)
+		if !ok {
+			continue
+		}
+		common := call.Common()
+		if body := payloadArg(callArgs(common), calleeName(common) == "Patch"); body != nil {
+			var values []ssa.Value
+			_, endpoints[i].Fields, values = payloadPaths(body, taintedVars)
+			// the fields of the payload flow into the sink even if the payload itself is not tainted
+			for _, v := range values {
+				taintedVars[call].addParent(v)
+			}
+			merged[body] = struct{}{}
+		}
+	}
+	hits := []SinkHit{}
+	for _, hit := range endpoints {
+		if al, ok := hit.Instr.(*ssa.Alloc); ok {
+			if _, found := merged[al]; found {
+				continue
+			}
+			_, hit.Fields, _ = payloadPaths(al, taintedVars)
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
+
+// Read is a value read back from a member written by an entry point.
+type Read struct {
+	Member *ssa.FieldAddr
+	Value  ssa.Value
+}
 
-	//fmt.Println(separator)
+// Flow is what an entry point writes, where it is read back, and the sinks reached from there.
+type Flow struct {
+	// Written are the members written by the entry point and its helpers, by position.
+	Written []*ssa.FieldAddr
+	Reads   []Read
+	Hits    []SinkHit
+	Guarded []GuardedHit
+}
+
+// FlowFrom tracks the entry point from the members it writes to the sinks.
+func (t *Tracker) FlowFrom(function *ssa.Function) Flow {
 	// For each handler, we find all the struct members written by the handler (recursively)
 	funQ := queue.New(100)
+	visited := map[*ssa.Function]struct{}{function: {}}
 	writtenMembers := make(map[*ssa.FieldAddr]struct{})
 	funQ.Put(function)
 	for !funQ.Empty() {
 		funs, _ := funQ.Get(1)
 		f := funs[0].(*ssa.Function)
-		t.trackSingleFunction(f, funQ, writtenMembers)
+		t.trackSingleFunction(f, funQ, visited, writtenMembers)
+	}
+	flow := Flow{}
+	for member := range writtenMembers {
+		flow.Written = append(flow.Written, member)
 	}
-	//fmt.Println("WRITTENMEMBERS for", function.Name(), ":")
-	//fmt.Println(writtenMembers)
+	sort.Slice(flow.Written, func(i, j int) bool { return flow.Written[i].Pos() < flow.Written[j].Pos() })
 
-	//fmt.Println(separator)
 	// For each written member, we visit all the methods (from the same struct as the handler) and find the read points
 	readMap := make(map[*ssa.Function][]ssa.Value)
-	// TODO: relax it later. Answer the question that why we care about Scheduler's methods
-	for _, method := range t.methodMap["k8s.io/kubernetes/pkg/scheduler.Scheduler"] {
-		// TODO: relax it later. So far let's only care about method "scheduleOne"
-		if method.Name() != "scheduleOne" {
-			continue
+	for _, member := range flow.Written {
+		memberReads := make(map[*ssa.Function][]ssa.Value)
+		for _, reader := range t.readers {
+			for _, method := range t.methodsOf(reader.Type) {
+				if method.Name() == reader.Method {
+					t.findReadPoints(method, reader, member, memberReads)
+				}
+			}
+		}
+		// the items put into a container, e.g. a workqueue, are read by the workers
+		if container, ok := containerOf(t.containers, member.Type()); ok {
+			t.findQueueReadPoints(member, container, memberReads)
+		}
+		for f, values := range memberReads {
+			readMap[f] = append(readMap[f], values...)
+			for _, v := range values {
+				flow.Reads = append(flow.Reads, Read{Member: member, Value: v})
+			}
 		}
-		t.findReadPoints(method, writtenMembers, readMap)
 	}
-	//fmt.Println("READMAP for writtenmembers from", function.Name(), ":")
-	//fmt.Println(readMap)
 
-	fmt.Println(separator)
-	endpoints := []ssa.Instruction{}
+	flow.Hits = []SinkHit{}
+	flow.Guarded = []GuardedHit{}
 	for f := range readMap {
-		taintedVars := make(map[ssa.Value]struct{})
-		for _, readPoint := range readMap[f] {
-			taintedVars[readPoint] = struct{}{}
+		subEndPoints, subGuarded := t.taintFrom(f, readMap[f])
+		flow.Hits = append(flow.Hits, subEndPoints...)
+		flow.Guarded = append(flow.Guarded, subGuarded...)
+	}
+	return flow
+}
+
+// SinksFrom returns the sinks reached from the members written by the entry point,
+// and the guarded sinks when implicit flow is enabled.
+func (t *Tracker) SinksFrom(function *ssa.Function) ([]SinkHit, []GuardedHit) {
+	flow := t.FlowFrom(function)
+	return flow.Hits, flow.Guarded
+}
+
+// Chain is what an entry point leads to: the members it writes, where they are read back,
+// and the sinks reached from there.
+type Chain struct {
+	collector.Entry
+	Flow
+}
+
+// Chains tracks the entry points named targetHandler, or all of them when it is empty.
+func (t *Tracker) Chains(targetHandler string) []Chain {
+	chains := []Chain{}
+	for _, entry := range t.entries {
+		if targetHandler == "" || strings.TrimSuffix(entry.Handler.Name(), "$bound") == targetHandler {
+			chains = append(chains, t.Chain(entry))
 		}
-		subEndPoints := t.trackReadPointWithinMethod(f, taintedVars)
-		endpoints = append(endpoints, subEndPoints...)
 	}
-	//fmt.Println("ENDPOINTS reached from", function.Name(), ":")
-	fmt.Println("HINT: node resources and pod resources could be changed as the side effects of", function.Name(), "by:")
-	fmt.Println(endpoints)
+	return chains
 }
 
-func (t *Tracker) generateMethodMap() {
-	for _, pkg := range t.prog.AllPackages() {
-		if pkg.Pkg.Path() == t.pattern {
-			for _, member := range pkg.Members {
-				if tm, ok := member.(*ssa.Type); ok {
-					//fmt.Println(tm.Type().String())
-					methodList := []*ssa.Function{}
-					ms1 := t.prog.MethodSets.MethodSet(tm.Type())
-					ms2 := t.prog.MethodSets.MethodSet(types.NewPointer(tm.Type()))
-					for i := 0; i < ms1.Len(); i = i + 1 {
-						methodList = append(methodList, t.prog.MethodValue(ms1.At(i)))
-					}
-					for i := 0; i < ms2.Len(); i = i + 1 {
-						t.prog.MethodValue(ms2.At(i))
-						methodList = append(methodList, t.prog.MethodValue(ms2.At(i)))
-					}
-					t.methodMap[tm.Type().String()] = methodList
+// Chain tracks the entry point.
+func (t *Tracker) Chain(entry collector.Entry) Chain {
+	return Chain{Entry: entry, Flow: t.FlowFrom(entry.Handler)}
+}
+
+// diagnose records a construct skipped in fun at pos, once.
+func (t *Tracker) diagnose(fun *ssa.Function, pos token.Pos, format string, args ...interface{}) {
+	d := collector.Diagnostic{
+		Position: t.prog.Fset.Position(pos),
+		Function: fun.String(),
+		Reason:   fmt.Sprintf(format, args...),
+	}
+	for _, other := range t.diagnostics {
+		if other == d {
+			return
+		}
+	}
+	t.diagnostics = append(t.diagnostics, d)
+}
+
+// Diagnostics returns the constructs skipped while tracking.
+func (t *Tracker) Diagnostics() []collector.Diagnostic {
+	return t.diagnostics
+}
+
+// Fprint writes the side effects of the chains to w, with the guarded ones when
+// implicit flow is enabled.
+func (t *Tracker) Fprint(w io.Writer, chains []Chain) {
+	for _, chain := range chains {
+		event, function := chain.Event, chain.Handler
+		fmt.Fprintln(w, separator)
+		if event == collector.Periodic || event == collector.Requeue {
+			fmt.Fprintln(w, "HINT: not caused by any watch event, but by a", strings.ToLower(event), "trigger")
+		}
+		fmt.Fprintln(w, "HINT: resources could be changed as the side effects of", event, function.Name(), "by:")
+		for _, hit := range chain.Hits {
+			fmt.Fprintf(w, "  %v write to %s at %v: %v\n", hit.Sink.Part, hit.Sink, t.prog.Fset.Position(hit.Instr.Pos()), hit.Instr)
+			if len(hit.Sources) != 0 {
+				fmt.Fprintln(w, "    object fields:", strings.Join(hit.Sources, ", "))
+			}
+			if len(hit.Fields) != 0 {
+				fmt.Fprintln(w, "    tainted fields:", strings.Join(hit.Fields, ", "))
+			}
+		}
+		if t.implicitFlow {
+			fmt.Fprintln(w, "HINT: resources could be changed depending on", function.Name(), "by:")
+			for _, hit := range chain.Guarded {
+				fmt.Fprintf(w, "  %v write to %s at %v: %v\n", hit.Sink.Part, hit.Sink, t.prog.Fset.Position(hit.Instr.Pos()), hit.Instr)
+				fmt.Fprintf(w, "    guarded by %v at %v\n", hit.Guard, t.prog.Fset.Position(hit.Guard.Cond.Pos()))
+				if len(hit.Sources) != 0 {
+					fmt.Fprintln(w, "    object fields:", strings.Join(hit.Sources, ", "))
 				}
 			}
 		}
 	}
 }
 
-func (t *Tracker) TrackEntryPoints(targetHandler string) {
-	for _, singleMap := range t.handlerMap {
-		for _, handler := range singleMap {
-			if handler.Name() == targetHandler+"$bound" {
-				t.trackSingleEntryPoint(handler)
+func (t *Tracker) generateMethodMap() {
+	if pkg := collector.PackageOf(t.prog, t.pattern); pkg != nil {
+		for _, member := range pkg.Members {
+			if tm, ok := member.(*ssa.Type); ok {
+				methodList := []*ssa.Function{}
+				ms1 := t.prog.MethodSets.MethodSet(tm.Type())
+				ms2 := t.prog.MethodSets.MethodSet(types.NewPointer(tm.Type()))
+				for i := 0; i < ms1.Len(); i = i + 1 {
+					methodList = append(methodList, t.prog.MethodValue(ms1.At(i)))
+				}
+				for i := 0; i < ms2.Len(); i = i + 1 {
+					t.prog.MethodValue(ms2.At(i))
+					methodList = append(methodList, t.prog.MethodValue(ms2.At(i)))
+				}
+				t.methodMap[collector.TrimVendor(tm.Type().String())] = methodList
 			}
 		}
 	}
 }
 
+// methodsOf returns the methods of the types of the package matching typ, a qualified
+// type name which may be vendored.
+func (t *Tracker) methodsOf(typ string) []*ssa.Function {
+	methods := []*ssa.Function{}
+	for name, methodList := range t.methodMap {
+		if collector.MatchPath(name, typ) {
+			methods = append(methods, methodList...)
+		}
+	}
+	return methods
+}
+
+// TrackEntryPoints prints the side effects of the entry points named targetHandler,
+// or of all of them when it is empty.
+func (t *Tracker) TrackEntryPoints(targetHandler string) {
+	t.Fprint(os.Stdout, t.Chains(targetHandler))
+}
+
+// SetImplicitFlow enables (or disables) the tracking of the sinks which are
+// control dependent on tainted branch conditions.
+func (t *Tracker) SetImplicitFlow(enabled bool) {
+	t.implicitFlow = enabled
+}
+
 func NewTracker(c *collector.Collector) *Tracker {
 	t := &Tracker{
-		pattern:    c.GetPattern(),
-		prog:       c.GetProg(),
-		handlerMap: c.GetHandlerMap(),
-		methodMap:  map[string][]*ssa.Function{},
-		endpoints:  map[string]struct{}{},
+		pattern:      c.GetPattern(),
+		prog:         c.GetProg(),
+		handlerMap:   c.GetHandlerMap(),
+		triggerMap:   c.GetTriggerMap(),
+		entries:      c.Entries(),
+		methodMap:    map[string][]*ssa.Function{},
+		fieldFuncs:   map[FieldKey][]*ssa.Function{},
+		callers:      map[*ssa.Package]map[*ssa.Function][]*ssa.Function{},
+		payloadSinks: map[string]Sink{},
+		methodSinks:  map[string]Sink{},
+		barriers:     append([]string{}, DefaultBarriers...),
+		sanitizers:   append([]string{}, DefaultSanitizers...),
+		containers:   append([]Container{}, DefaultContainers...),
 	}
 	t.generateMethodMap()
-	t.endpoints["new k8s.io/kubernetes/vendor/k8s.io/api/core/v1.Binding (complit)"] = struct{}{}
+	t.generateFieldFuncs()
+	for name, sink := range defaultPayloadSinks {
+		t.payloadSinks[name] = sink
+	}
+	for name, sink := range defaultMethodSinks {
+		t.methodSinks[name] = sink
+	}
 
 	return t
 }
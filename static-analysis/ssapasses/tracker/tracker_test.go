@@ -3,3 +3,333 @@
 // SPDX-License-Identifier: BSD-2
 
 package tracker
+
+import (
+	"bytes"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/collector"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testdataPkg = "kubetorch/ssapasses/tracker/testdata"
+
+var (
+	loadOnce sync.Once
+	loaded   *collector.Collector
+)
+
+// newTestTracker returns a fresh tracker over the testdata, which is loaded only once.
+func newTestTracker() *Tracker {
+	loadOnce.Do(func() {
+		loaded = collector.NewCollector(testdataPkg)
+		loaded.CollectEntryPoints()
+	})
+	return NewTracker(loaded)
+}
+
+func findMethod(t *testing.T, tr *Tracker, method string) *ssa.Function {
+	for _, fun := range tr.methodMap[testdataPkg+".controller"] {
+		if fun.Name() == method {
+			return fun
+		}
+	}
+	t.Fatalf("method %s not found", method)
+	return nil
+}
+
+// trackParam taints the first parameter after the receiver of the controller's method
+// and returns the sinks it reaches.
+func trackParam(t *testing.T, tr *Tracker, method string) []SinkHit {
+	fun := findMethod(t, tr, method)
+	hits, _ := tr.taintFrom(fun, []ssa.Value{fun.Params[1]})
+	return hits
+}
+
+func TestSinkClassification(t *testing.T) {
+	tr := newTestTracker()
+	cases := []struct {
+		method string
+		sink   Sink
+		fields []string
+	}{
+		{"bind", Sink{Resource: "Pod", Part: PartSubresource, Subresource: "binding"},
+			[]string{"ObjectMeta.Name", "ObjectMeta.Namespace", "ObjectMeta.UID"}},
+		{"updateStatus", Sink{Resource: "Pod", Part: PartStatus}, []string{}},
+		{"updateSpec", Sink{Resource: "Pod", Part: PartSpec}, []string{}},
+		{"removeFinalizers", Sink{Resource: "Pod", Part: PartMetadata}, []string{}},
+		{"patchLabels", Sink{Resource: "Pod", Part: PartMetadata}, []string{"metadata.labels"}},
+		{"patchStatus", Sink{Resource: "Pod", Part: PartStatus}, []string{}},
+		// the resourceVersion is a precondition, not a metadata write
+		{"patchStatusWithVersion", Sink{Resource: "Pod", Part: PartStatus}, []string{"metadata.resourceVersion"}},
+		{"patchSpecAndStatus", Sink{Resource: "Pod", Part: PartObject}, []string{}},
+	}
+	for _, c := range cases {
+		hits := trackParam(t, tr, c.method)
+		if len(hits) != 1 {
+			t.Errorf("%s: sinks len should be 1, but %d actually", c.method, len(hits))
+			continue
+		}
+		if hits[0].Sink != c.sink {
+			t.Errorf("%s: sink should be %v, but %v actually", c.method, c.sink, hits[0].Sink)
+		}
+		if !reflect.DeepEqual(hits[0].Fields, c.fields) {
+			t.Errorf("%s: tainted fields should be %v, but %v actually", c.method, c.fields, hits[0].Fields)
+		}
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	tr := newTestTracker()
+	for method, expected := range map[string]bool{
+		"patchLabels":            false,
+		"patchStatusWithVersion": true,
+		// the UID of a Go struct body
+		"patchStatusWithUID": true,
+	} {
+		hits := trackParam(t, tr, method)
+		if len(hits) != 1 {
+			t.Errorf("%s: sinks len should be 1, but %d actually", method, len(hits))
+			continue
+		}
+		if call, ok := hits[0].Instr.(*ssa.Call); !ok || HasPrecondition(call) != expected {
+			t.Errorf("%s: the precondition should be %v, but %v actually", method, expected, !expected)
+		}
+	}
+}
+
+func TestFieldSources(t *testing.T) {
+	tr := newTestTracker()
+	cases := []struct {
+		method  string
+		sources []string
+	}{
+		{"bind", []string{"obj.ObjectMeta.Name", "obj.ObjectMeta.Namespace", "obj.ObjectMeta.UID"}},
+		// node is not derived from the pod, while info.Pod is the pod itself
+		{"bindQueued", []string{"obj.ObjectMeta.Name", "obj.ObjectMeta.Namespace", "obj.ObjectMeta.UID", "obj.Spec.NodeName"}},
+		{"updateStatus", []string{"obj"}},
+		{"patchLabels", []string{"obj.ObjectMeta.Labels", "obj.ObjectMeta.Name"}},
+	}
+	for _, c := range cases {
+		hits := trackParam(t, tr, c.method)
+		if len(hits) != 1 {
+			t.Errorf("%s: sinks len should be 1, but %d actually", c.method, len(hits))
+			continue
+		}
+		if !reflect.DeepEqual(hits[0].Sources, c.sources) {
+			t.Errorf("%s: sources should be %v, but %v actually", c.method, c.sources, hits[0].Sources)
+		}
+	}
+}
+
+func TestPayloadFieldsAcrossCalls(t *testing.T) {
+	tr := newTestTracker()
+	// node is tainted by a later argument of the same call to bind
+	hits := trackParam(t, tr, "bindQueued")
+	fields := []string{"ObjectMeta.Name", "ObjectMeta.Namespace", "ObjectMeta.UID", "Target.Name"}
+	if len(hits) != 1 || !reflect.DeepEqual(hits[0].Fields, fields) {
+		t.Errorf("tainted fields should be %v, but %v actually", fields, hits)
+	}
+}
+
+func TestControlDependence(t *testing.T) {
+	tr := newTestTracker()
+	tr.SetImplicitFlow(true)
+	cases := []struct {
+		method  string
+		sources []string
+	}{
+		// the Delete is only executed on one side of the branch
+		{"deleteIfUnscheduled", []string{"obj.Spec.NodeName"}},
+		// the name passed to Delete is selected by the branch
+		{"deleteByPhase", []string{"obj.Status.Phase"}},
+	}
+	for _, c := range cases {
+		fun := findMethod(t, tr, c.method)
+		hits, guarded := tr.taintFrom(fun, []ssa.Value{fun.Params[1]})
+		if len(hits) != 0 {
+			t.Errorf("%s: data flow sinks len should be 0, but %d actually", c.method, len(hits))
+		}
+		if len(guarded) != 1 {
+			t.Errorf("%s: guarded sinks len should be 1, but %d actually", c.method, len(guarded))
+			continue
+		}
+		if guarded[0].Sink.Part != PartObject || !reflect.DeepEqual(guarded[0].Sources, c.sources) {
+			t.Errorf("%s: guarded sink should be an object write guarded by %v, but %v by %v actually",
+				c.method, c.sources, guarded[0].Sink, guarded[0].Sources)
+		}
+	}
+
+	// the Delete in the infinite loop is executed on both sides of the branch
+	fun := findMethod(t, tr, "deleteForever")
+	if _, guarded := tr.taintFrom(fun, []ssa.Value{fun.Params[1]}); len(guarded) != 0 {
+		t.Errorf("deleteForever: guarded sinks len should be 0, but %d actually", len(guarded))
+	}
+	tr.SetImplicitFlow(false)
+	fun = findMethod(t, tr, "deleteIfUnscheduled")
+	if _, guarded := tr.taintFrom(fun, []ssa.Value{fun.Params[1]}); len(guarded) != 0 {
+		t.Errorf("guarded sinks should not be tracked by default, but %d found", len(guarded))
+	}
+}
+
+// TestExplicitFlow checks that the data flows through BinOps and Phis without the
+// implicit flow, and that the branches on the object do not taint their sinks.
+func TestExplicitFlow(t *testing.T) {
+	tr := newTestTracker()
+	for _, method := range []string{"deleteByKey", "deleteByMergedName"} {
+		fun := findMethod(t, tr, method)
+		hits, guarded := tr.taintFrom(fun, []ssa.Value{fun.Params[1]})
+		if len(hits) != 1 || len(guarded) != 0 {
+			t.Errorf("%s: sinks len should be 1 and guarded len 0, but %d and %d actually", method, len(hits), len(guarded))
+		}
+	}
+	if hits := trackParam(t, tr, "deleteIfUnscheduled"); len(hits) != 0 {
+		t.Errorf("deleteIfUnscheduled: sinks len should be 0 without implicit flow, but %d actually", len(hits))
+	}
+}
+
+func TestModelPatterns(t *testing.T) {
+	for _, test := range []struct {
+		pkg, member string
+		patterns    []string
+		match       bool
+	}{
+		{"k8s.io/kubernetes/vendor/k8s.io/apimachinery/pkg/api/errors", "IsNotFound", DefaultSanitizers, true},
+		{"errors", "As", DefaultSanitizers, true},
+		{"example.com/myerrors", "IsNotFound", DefaultSanitizers, false},
+		{"github.com/pkg/errors", "Is", DefaultSanitizers, false},
+		{"errors", "Unwrap", DefaultSanitizers, false},
+		{"k8s.io/klog/v2", "Infof", DefaultBarriers, true},
+		{"k8s.io/klogx", "Infof", DefaultBarriers, false},
+		{"k8s.io/client-go/tools/record", "EventRecorder.Eventf", DefaultBarriers, true},
+		{"k8s.io/client-go/tools/record", "Recorder.Eventf", DefaultBarriers, false},
+		{"fmt", "Errorf", DefaultBarriers, true},
+		{"fmt", "Sprintf", DefaultBarriers, false},
+	} {
+		if match := matchAny(test.pkg, test.member, test.patterns); match != test.match {
+			t.Errorf("%s.%s: match should be %v, but %v actually", test.pkg, test.member, test.match, match)
+		}
+	}
+}
+
+func TestBarriersAndSanitizers(t *testing.T) {
+	tr := newTestTracker()
+	// the name is returned by a helper
+	if hits := trackParam(t, tr, "deleteByName"); len(hits) != 1 {
+		t.Errorf("deleteByName: sinks len should be 1, but %d actually", len(hits))
+	}
+	// fmt.Errorf is a default barrier
+	if hits := trackParam(t, tr, "deleteByError"); len(hits) != 0 {
+		t.Errorf("deleteByError: sinks len should be 0, but %d actually", len(hits))
+	}
+	if hits := trackParam(t, tr, "deleteByHash"); len(hits) != 1 {
+		t.Errorf("deleteByHash: sinks len should be 1, but %d actually", len(hits))
+	}
+	tr.AddSanitizers(testdataPkg + ".hashOf")
+	if hits := trackParam(t, tr, "deleteByHash"); len(hits) != 0 {
+		t.Errorf("deleteByHash: sinks len should be 0 once hashOf is a sanitizer, but %d actually", len(hits))
+	}
+}
+
+func TestWorkqueueLinking(t *testing.T) {
+	tr := newTestTracker()
+	var handler *ssa.Function
+	for _, singleMap := range tr.handlerMap {
+		if fn, ok := singleMap["Add"]; ok && fn.Name() == "addPod$bound" {
+			handler = fn
+		}
+	}
+	if handler == nil {
+		t.Fatal("handler addPod not found")
+	}
+	// addPod -> queue.Add(key) -> queue.Get() -> syncHandler(key) -> Lister().Get(name) -> UpdateStatus
+	hits, _ := tr.SinksFrom(handler)
+	if len(hits) != 1 {
+		t.Fatalf("sinks len should be 1, but %d actually", len(hits))
+	}
+	sink := Sink{Resource: "Pod", Part: PartStatus}
+	if hits[0].Sink != sink || hits[0].Instr.Parent().Name() != "syncPod" {
+		t.Errorf("sink should be %v in syncPod, but %v in %s actually", sink, hits[0].Sink, hits[0].Instr.Parent().Name())
+	}
+	if sources := []string{"obj"}; !reflect.DeepEqual(hits[0].Sources, sources) {
+		t.Errorf("sources should be %v, but %v actually", sources, hits[0].Sources)
+	}
+
+	flow := tr.FlowFrom(handler)
+	if len(flow.Written) != 1 || FieldName(flow.Written[0].X, flow.Written[0].Field) != "queue" {
+		t.Fatalf("written members should be [queue], but %v actually", flow.Written)
+	}
+	if len(flow.Reads) != 1 || flow.Reads[0].Value.Parent().Name() != "processNextWorkItem" {
+		t.Fatalf("the queue should be read in processNextWorkItem, but %v actually", flow.Reads)
+	}
+	// the witness goes from the key got from the queue to the sink
+	witness := flow.Hits[0].Witness
+	if len(witness) < 2 || witness[0] != flow.Reads[0].Value || witness[len(witness)-1] != flow.Hits[0].Instr.(ssa.Value) {
+		t.Errorf("witness should go from %v to %v, but %v actually", flow.Reads[0].Value, flow.Hits[0].Instr, witness)
+	}
+}
+
+func TestStaleReads(t *testing.T) {
+	tr := newTestTracker()
+	type read struct {
+		function string
+		kind     string
+		sink     Sink
+	}
+	expected := []read{
+		{"deleteIndexedPod", "", Sink{Resource: "Pod", Part: PartObject}},
+		{"deletePodsOnNode", "Pod", Sink{Resource: "Pod", Part: PartObject}},
+		{"syncPod", "Pod", Sink{Resource: "Pod", Part: PartStatus}},
+	}
+	actual := []read{}
+	reads := tr.StaleReads()
+	for _, sr := range reads {
+		actual = append(actual, read{sr.Read.Parent().Name(), sr.Kind, sr.Hit.Sink})
+	}
+	sort.Slice(actual, func(i, j int) bool { return actual[i].function < actual[j].function })
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("stale reads should be %v, but %v actually", expected, actual)
+	}
+	var out bytes.Buffer
+	tr.FprintStaleReads(&out, reads)
+	if !strings.Contains(out.String(), "cache read of unknown at") {
+		t.Errorf("the untyped indexer read should be printed as unknown, but %q actually", out.String())
+	}
+}
+
+func TestReadersAndBudgets(t *testing.T) {
+	tr := newTestTracker()
+	var handler *ssa.Function
+	for _, singleMap := range tr.handlerMap {
+		if fn, ok := singleMap["Add"]; ok && fn.Name() == "addPod$bound" {
+			handler = fn
+		}
+	}
+	if handler == nil {
+		t.Fatal("handler addPod not found")
+	}
+	// the queue written by addPod is read by ByIndex in deletePodsOnNode, as far as the reader tells,
+	// whose type matches once its vendor prefix is removed
+	tr.AddReaders(Reader{Type: "k8s.io/kubernetes/vendor/" + testdataPkg + ".Controller", Method: "deletePodsOnNode", Call: "ByIndex", Field: 3})
+	flow := tr.FlowFrom(handler)
+	readers := []string{}
+	for _, read := range flow.Reads {
+		readers = append(readers, read.Value.Parent().Name())
+	}
+	sort.Strings(readers)
+	if expected := []string{"deletePodsOnNode", "processNextWorkItem"}; !reflect.DeepEqual(readers, expected) {
+		t.Errorf("the queue should be read in %v, but %v actually", expected, readers)
+	}
+	if len(flow.Hits) != 2 {
+		t.Errorf("sinks len should be 2, but %d actually", len(flow.Hits))
+	}
+
+	// enqueue writing the queue is not searched within the budget
+	tr.SetBudgets(Budgets{Functions: 1})
+	if flow := tr.FlowFrom(handler); len(flow.Written) != 0 || len(flow.Hits) != 0 {
+		t.Errorf("nothing should be found within the budget, but %v actually", flow.Written)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 VMware, Inc.
+//
+// SPDX-License-Identifier: BSD-2
+
+package tracker
+
+import (
+	"go/types"
+	"golang.org/x/tools/go/ssa"
+	"kubetorch/ssapasses/collector"
+)
+
+const workqueuePkg = "k8s.io/client-go/util/workqueue"
+
+// Container models a type holding the items put by the entry points until a worker
+// gets them back. Writes are the methods putting an item in, Reads the methods
+// returning it. Type is a package path or a qualified type name, matched without the
+// vendor prefixes, see collector.MatchPath.
+type Container struct {
+	Type   string
+	Writes []string
+	Reads  []string
+}
+
+// DefaultContainers are the workqueues of client-go.
+var DefaultContainers = []Container{
+	{Type: workqueuePkg, Writes: []string{"Add", "AddAfter", "AddRateLimited"}, Reads: []string{"Get"}},
+}
+
+// containerOf returns the model of the container of type typ, if any.
+func containerOf(containers []Container, typ types.Type) (Container, bool) {
+	named, ok := DerefType(typ).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return Container{}, false
+	}
+	path := named.Obj().Pkg().Path()
+	for _, c := range containers {
+		if collector.MatchPath(path, c.Type) || collector.MatchPath(path+"."+named.Obj().Name(), c.Type) {
+			return c, true
+		}
+	}
+	return Container{}, false
+}
+
+// FieldKey identifies a field of a struct type.
+type FieldKey struct {
+	Type  string
+	Field int
+}
+
+// KeyOf returns the key of the field addressed by fa.
+func KeyOf(fa *ssa.FieldAddr) FieldKey {
+	return FieldKey{Type: DerefType(fa.X.Type()).String(), Field: fa.Field}
+}
+
+// IsQueue tells whether typ is one of the workqueues of client-go.
+func IsQueue(typ types.Type) bool {
+	_, ok := containerOf(DefaultContainers, typ)
+	return ok
+}
+
+// IsQueueWrite tells whether the call puts an item into a workqueue.
+func IsQueueWrite(common *ssa.CallCommon) bool {
+	if !common.IsInvoke() {
+		return false
+	}
+	c, ok := containerOf(DefaultContainers, common.Value.Type())
+	return ok && collector.Contains(c.Writes, common.Method.Name())
+}
+
+// queueMethod returns the method invoked on the container loaded from fa, if any.
+func (t *Tracker) queueMethod(fa *ssa.FieldAddr) (*ssa.Call, string) {
+	if _, ok := containerOf(t.containers, fa.Type()); !ok {
+		return nil, ""
+	}
+	for _, ref := range *fa.Referrers() {
+		uo, ok := ref.(*ssa.UnOp)
+		if !ok {
+			continue
+		}
+		for _, uref := range *uo.Referrers() {
+			if call, ok := uref.(*ssa.Call); ok && call.Common().IsInvoke() && call.Common().Value == uo {
+				return call, call.Common().Method.Name()
+			}
+		}
+	}
+	return nil, ""
+}
+
+// findQueueReadPoints finds the items got from the container written by the handler:
+// key, quit := c.queue.Get() in the methods of the same type.
+func (t *Tracker) findQueueReadPoints(member *ssa.FieldAddr, container Container, readMap map[*ssa.Function][]ssa.Value) {
+	key := KeyOf(member)
+	for _, method := range t.methodsOf(key.Type) {
+		if method.Signature.Recv() == nil || len(method.Params) == 0 {
+			continue
+		}
+		for _, ref := range *method.Params[0].Referrers() {
+			fa, ok := ref.(*ssa.FieldAddr)
+			if !ok || KeyOf(fa) != key {
+				continue
+			}
+			call, name := t.queueMethod(fa)
+			if !collector.Contains(container.Reads, name) {
+				continue
+			}
+			if _, ok := call.Type().(*types.Tuple); !ok {
+				readMap[method] = append(readMap[method], call)
+				continue
+			}
+			for _, cref := range *call.Referrers() {
+				if ex, ok := cref.(*ssa.Extract); ok && ex.Index == 0 {
+					readMap[method] = append(readMap[method], ex)
+				}
+			}
+		}
+	}
+}
+
+// generateFieldFuncs records the functions stored into the fields of the types
+// of the package, e.g. c.syncHandler = c.syncDeployment.
+func (t *Tracker) generateFieldFuncs() {
+	if pkg := collector.PackageOf(t.prog, t.pattern); pkg != nil {
+		for _, fun := range collector.PackageFunctions(t.prog, pkg) {
+			for _, block := range fun.Blocks {
+				for _, instr := range block.Instrs {
+					st, ok := instr.(*ssa.Store)
+					if !ok {
+						continue
+					}
+					fa, ok := st.Addr.(*ssa.FieldAddr)
+					if !ok {
+						continue
+					}
+					if fn := collector.FuncOf(st.Val); fn != nil {
+						t.fieldFuncs[KeyOf(fa)] = append(t.fieldFuncs[KeyOf(fa)], fn)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Callees returns the functions with a body which may be called, also through the
+// fields the functions of the package are stored into.
+func (t *Tracker) Callees(common *ssa.CallCommon) []*ssa.Function {
+	if common.IsInvoke() {
+		return nil
+	}
+	funs := []*ssa.Function{}
+	switch common.Value.(type) {
+	case *ssa.Function, *ssa.MakeClosure:
+		if fn := collector.FuncOf(common.Value); fn != nil {
+			funs = append(funs, fn)
+		}
+	case *ssa.UnOp:
+		// the function is loaded from a field, e.g. c.syncHandler(key)
+		if fa, ok := common.Value.(*ssa.UnOp).X.(*ssa.FieldAddr); ok {
+			funs = append(funs, t.fieldFuncs[KeyOf(fa)]...)
+		}
+	}
+	withBody := []*ssa.Function{}
+	for _, fn := range funs {
+		if len(fn.Blocks) != 0 {
+			withBody = append(withBody, fn)
+		}
+	}
+	return withBody
+}
+
+// lookupByKey tells whether the call looks an object up by a tainted key or name,
+// e.g. podLister.Pods(ns).Get(name). The result is then the informer object itself.
+func lookupByKey(call *ssa.Call, taintedVars map[ssa.Value]*taint) bool {
+	returnsObject := IsAPIObject(call.Type())
+	if tuple, ok := call.Type().(*types.Tuple); ok {
+		for i := 0; i < tuple.Len(); i++ {
+			returnsObject = returnsObject || IsAPIObject(tuple.At(i).Type())
+		}
+	}
+	if !returnsObject {
+		return false
+	}
+	for _, arg := range call.Common().Args {
+		if b, ok := arg.Type().Underlying().(*types.Basic); ok && b.Info()&types.IsString != 0 {
+			if _, found := taintedVars[arg]; found {
+				return true
+			}
+		}
+	}
+	return false
+}